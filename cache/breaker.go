@@ -0,0 +1,231 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultBreakerFailureThreshold = 5
+	defaultBreakerCooldown         = 30 * time.Second
+)
+
+type Cache interface {
+	Get(ctx context.Context, key string, out any) error
+	Set(ctx context.Context, key string, val any, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// Pinger is implemented by caches backed by a remote store, to check it is reachable.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// PrefixDeleter is implemented by caches that can delete all the keys starting with a prefix.
+type PrefixDeleter interface {
+	// DeletePrefix deletes the keys starting with prefix and returns how many were deleted.
+	DeletePrefix(ctx context.Context, prefix string) (int, error)
+}
+
+type BreakerState int32
+
+const (
+	BreakerClosed BreakerState = iota
+	BreakerOpen
+	BreakerHalfOpen
+)
+
+func (s BreakerState) String() string {
+	switch s {
+	case BreakerClosed:
+		return "closed"
+	case BreakerOpen:
+		return "open"
+	case BreakerHalfOpen:
+		return "half-open"
+	}
+	return "unknown"
+}
+
+type BreakerConfig struct {
+	// FailureThreshold is the number of consecutive failures that opens the breaker.
+	FailureThreshold int
+	// Cooldown is how long the cache is bypassed before a trial call is let through.
+	Cooldown time.Duration
+}
+
+type BreakerStats struct {
+	State               string `json:"state"`
+	ConsecutiveFailures int    `json:"consecutive_failures"`
+	Opened              uint64 `json:"opened"`
+	Recovered           uint64 `json:"recovered"`
+	Bypassed            uint64 `json:"bypassed"`
+}
+
+// Breaker wraps a Cache and stops calling it for a cool-down period after repeated failures,
+// so an unavailable cache does not add its timeout to every request.
+// Cache misses are not considered failures.
+type Breaker struct {
+	cache Cache
+	cfg   BreakerConfig
+	now   func() time.Time
+
+	mu       sync.Mutex
+	state    BreakerState
+	failures int
+	openedAt time.Time
+	trial    bool
+
+	opened    atomic.Uint64
+	recovered atomic.Uint64
+	bypassed  atomic.Uint64
+}
+
+func NewBreaker(c Cache, cfg BreakerConfig) *Breaker {
+	if cfg.FailureThreshold <= 0 {
+		cfg.FailureThreshold = defaultBreakerFailureThreshold
+	}
+	if cfg.Cooldown <= 0 {
+		cfg.Cooldown = defaultBreakerCooldown
+	}
+	return &Breaker{
+		cache: c,
+		cfg:   cfg,
+		now:   time.Now,
+	}
+}
+
+func (b *Breaker) Get(ctx context.Context, key string, out any) error {
+	if err := b.allow(ctx); err != nil {
+		return err
+	}
+	err := b.cache.Get(ctx, key, out)
+	b.record(ctx, err)
+	return err
+}
+
+func (b *Breaker) Set(ctx context.Context, key string, val any, ttl time.Duration) error {
+	if err := b.allow(ctx); err != nil {
+		return err
+	}
+	err := b.cache.Set(ctx, key, val, ttl)
+	b.record(ctx, err)
+	return err
+}
+
+func (b *Breaker) Delete(ctx context.Context, key string) error {
+	if err := b.allow(ctx); err != nil {
+		return err
+	}
+	err := b.cache.Delete(ctx, key)
+	b.record(ctx, err)
+	return err
+}
+
+// Ping checks the wrapped cache even while the breaker is open, so health checks see when it recovers.
+func (b *Breaker) Ping(ctx context.Context) error {
+	if p, ok := b.cache.(Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// DeletePrefix deletes the keys of the wrapped cache even while the breaker is open, it is an explicit operation
+// and not part of serving requests.
+func (b *Breaker) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	if d, ok := b.cache.(PrefixDeleter); ok {
+		return d.DeletePrefix(ctx, prefix)
+	}
+	return 0, ErrNotSupported
+}
+
+func (b *Breaker) State() BreakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func (b *Breaker) Stats() BreakerStats {
+	b.mu.Lock()
+	state, failures := b.state, b.failures
+	b.mu.Unlock()
+	return BreakerStats{
+		State:               state.String(),
+		ConsecutiveFailures: failures,
+		Opened:              b.opened.Load(),
+		Recovered:           b.recovered.Load(),
+		Bypassed:            b.bypassed.Load(),
+	}
+}
+
+func (b *Breaker) allow(ctx context.Context) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case BreakerOpen:
+		if b.now().Sub(b.openedAt) < b.cfg.Cooldown {
+			b.bypassed.Add(1)
+			return ErrCacheUnavailable
+		}
+		b.setState(ctx, BreakerHalfOpen)
+		b.trial = true
+		return nil
+	case BreakerHalfOpen:
+		// only a single trial call is let through while half-open
+		if b.trial {
+			b.bypassed.Add(1)
+			return ErrCacheUnavailable
+		}
+		b.trial = true
+	}
+	return nil
+}
+
+func (b *Breaker) record(ctx context.Context, err error) {
+	if errors.Is(err, context.Canceled) || ctx.Err() != nil {
+		// the caller went away or ran out of time, e.g. the request timeout passed, this says nothing about the
+		// cache health
+		b.mu.Lock()
+		b.trial = false
+		b.mu.Unlock()
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.trial = false
+
+	if err == nil || errors.Is(err, ErrCacheMiss) {
+		b.failures = 0
+		if b.state != BreakerClosed {
+			b.recovered.Add(1)
+			b.setState(ctx, BreakerClosed)
+		}
+		return
+	}
+
+	b.failures++
+	if b.state == BreakerHalfOpen || b.failures >= b.cfg.FailureThreshold {
+		if b.state != BreakerOpen {
+			log.Errorf(ctx, "Cache failed %d consecutive times, last error: %v", b.failures, err)
+			b.opened.Add(1)
+		}
+		b.openedAt = b.now()
+		b.setState(ctx, BreakerOpen)
+	}
+}
+
+// setState must be called while holding b.mu.
+func (b *Breaker) setState(ctx context.Context, state BreakerState) {
+	if b.state == state {
+		return
+	}
+	log.Infof(ctx, "Cache breaker state changed from %s to %s", b.state, state)
+	b.state = state
+}
@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+type failingCache struct {
+	err   error
+	calls int
+}
+
+func (f *failingCache) Get(_ context.Context, _ string, _ any) error {
+	f.calls++
+	return f.err
+}
+
+func (f *failingCache) Set(_ context.Context, _ string, _ any, _ time.Duration) error {
+	f.calls++
+	return f.err
+}
+
+func (f *failingCache) Delete(_ context.Context, _ string) error {
+	f.calls++
+	return f.err
+}
+
+func TestBreaker(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Now()
+	fc := &failingCache{err: errors.New("connection refused")}
+	b := NewBreaker(fc, BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+
+	var out string
+	require.Error(t, b.Get(ctx, "k", &out))
+	require.Equal(t, BreakerClosed, b.State())
+	require.Error(t, b.Get(ctx, "k", &out))
+	require.Equal(t, BreakerOpen, b.State())
+
+	// while open the underlying cache is not called
+	require.ErrorIs(t, b.Get(ctx, "k", &out), ErrCacheUnavailable)
+	require.ErrorIs(t, b.Set(ctx, "k", "v", time.Minute), ErrCacheUnavailable)
+	require.Equal(t, 2, fc.calls)
+
+	// after the cooldown a failed trial call opens the breaker again
+	now = now.Add(time.Minute)
+	require.NotErrorIs(t, b.Get(ctx, "k", &out), ErrCacheUnavailable)
+	require.Equal(t, BreakerOpen, b.State())
+	require.Equal(t, 3, fc.calls)
+
+	// a cache miss is a healthy response and closes the breaker
+	now = now.Add(time.Minute)
+	fc.err = ErrCacheMiss
+	require.ErrorIs(t, b.Get(ctx, "k", &out), ErrCacheMiss)
+	require.Equal(t, BreakerClosed, b.State())
+
+	stats := b.Stats()
+	require.Equal(t, "closed", stats.State)
+	require.EqualValues(t, 2, stats.Opened)
+	require.EqualValues(t, 1, stats.Recovered)
+	require.EqualValues(t, 2, stats.Bypassed)
+}
+
+func TestBreaker_ContextDone(t *testing.T) {
+	t.Parallel()
+
+	now := time.Now()
+	fc := &failingCache{err: errors.New("connection refused")}
+	b := NewBreaker(fc, BreakerConfig{FailureThreshold: 2, Cooldown: time.Minute})
+	b.now = func() time.Time { return now }
+
+	expiredCtx, cancel := context.WithDeadline(context.Background(), now.Add(-time.Second))
+	t.Cleanup(cancel)
+
+	// calls of callers that ran out of time are not counted as failures
+	var out string
+	for range 3 {
+		require.Error(t, b.Get(expiredCtx, "k", &out))
+	}
+	require.Equal(t, BreakerClosed, b.State())
+	require.Zero(t, b.Stats().ConsecutiveFailures)
+
+	ctx := context.Background()
+	require.Error(t, b.Get(ctx, "k", &out))
+	require.Error(t, b.Get(ctx, "k", &out))
+	require.Equal(t, BreakerOpen, b.State())
+
+	// a trial call that ran out of time lets the next call try again
+	now = now.Add(time.Minute)
+	fc.err = context.DeadlineExceeded
+	require.ErrorIs(t, b.Get(expiredCtx, "k", &out), context.DeadlineExceeded)
+	require.Equal(t, BreakerHalfOpen, b.State())
+	fc.err = nil
+	require.NoError(t, b.Get(ctx, "k", &out))
+	require.Equal(t, BreakerClosed, b.State())
+}
@@ -0,0 +1,12 @@
+package cache
+
+import "errors"
+
+var (
+	// ErrCacheMiss is returned by cache implementations when a key does not exist or has expired.
+	ErrCacheMiss = errors.New("cache miss")
+	// ErrCacheUnavailable is returned when the cache is bypassed because it is considered unhealthy.
+	ErrCacheUnavailable = errors.New("cache unavailable")
+	// ErrNotSupported is returned when the cache implementation does not support an operation.
+	ErrNotSupported = errors.New("not supported by the cache")
+)
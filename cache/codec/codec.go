@@ -0,0 +1,211 @@
+package codec
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"github.com/vmihailenco/msgpack/v5"
+	"io"
+	"sync"
+)
+
+// Encoded payloads start with the magic byte followed by a format byte holding the serialization
+// in the high nibble and the compression in the low nibble. Payloads without the magic byte are
+// plain JSON, as written before codecs were introduced.
+const (
+	magicByte  byte = 0xdc
+	headerSize      = 2
+
+	defaultMinCompressSize = 1024
+)
+
+type Serialization byte
+
+const (
+	SerializationJSON    Serialization = 1
+	SerializationMsgPack Serialization = 2
+)
+
+type Compression byte
+
+const (
+	CompressionNone Compression = 0
+	CompressionGzip Compression = 1
+	CompressionZstd Compression = 2
+)
+
+var serializations = map[string]Serialization{
+	"json":    SerializationJSON,
+	"msgpack": SerializationMsgPack,
+}
+
+var compressions = map[string]Compression{
+	"none": CompressionNone,
+	"gzip": CompressionGzip,
+	"zstd": CompressionZstd,
+}
+
+// The zstd encoder and decoder are shared by all codecs, they are created on first use so a construction
+// error is returned to the caller instead of leaving a nil encoder behind.
+var (
+	zstdEncoder = sync.OnceValues(func() (*zstd.Encoder, error) { return zstd.NewWriter(nil) })
+	zstdDecoder = sync.OnceValues(func() (*zstd.Decoder, error) { return zstd.NewReader(nil) })
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+)
+
+type Codec struct {
+	serialization   Serialization
+	compression     Compression
+	minCompressSize int
+}
+
+func New(serialization Serialization, compression Compression) (*Codec, error) {
+	if serialization != SerializationJSON && serialization != SerializationMsgPack {
+		return nil, fmt.Errorf("unknown serialization %d", serialization)
+	}
+	if compression != CompressionNone && compression != CompressionGzip && compression != CompressionZstd {
+		return nil, fmt.Errorf("unknown compression %d", compression)
+	}
+	return &Codec{
+		serialization:   serialization,
+		compression:     compression,
+		minCompressSize: defaultMinCompressSize,
+	}, nil
+}
+
+// Parse builds a codec from the serialization and compression names, empty names select JSON without compression.
+func Parse(serialization, compression string) (*Codec, error) {
+	if serialization == "" {
+		serialization = "json"
+	}
+	if compression == "" {
+		compression = "none"
+	}
+	s, ok := serializations[serialization]
+	if !ok {
+		return nil, fmt.Errorf("unknown serialization %q", serialization)
+	}
+	c, ok := compressions[compression]
+	if !ok {
+		return nil, fmt.Errorf("unknown compression %q", compression)
+	}
+	return New(s, c)
+}
+
+func Default() *Codec {
+	return &Codec{
+		serialization:   SerializationJSON,
+		compression:     CompressionNone,
+		minCompressSize: defaultMinCompressSize,
+	}
+}
+
+// SetMinCompressSize sets the payload size below which values are stored uncompressed.
+func (c *Codec) SetMinCompressSize(n int) {
+	c.minCompressSize = n
+}
+
+func (c *Codec) Marshal(v any) ([]byte, error) {
+	data, err := serialize(c.serialization, v)
+	if err != nil {
+		return nil, err
+	}
+
+	compression := c.compression
+	if len(data) < c.minCompressSize {
+		compression = CompressionNone
+	}
+
+	out := make([]byte, headerSize, headerSize+len(data))
+	out[0] = magicByte
+	out[1] = byte(c.serialization)<<4 | byte(compression)
+
+	switch compression {
+	case CompressionGzip:
+		buf := bytes.NewBuffer(out)
+		zw := gzipWriters.Get().(*gzip.Writer)
+		defer gzipWriters.Put(zw)
+		zw.Reset(buf)
+		if _, err := zw.Write(data); err != nil {
+			return nil, fmt.Errorf("failed to gzip value: %w", err)
+		}
+		if err := zw.Close(); err != nil {
+			return nil, fmt.Errorf("failed to gzip value: %w", err)
+		}
+		return buf.Bytes(), nil
+	case CompressionZstd:
+		enc, err := zstdEncoder()
+		if err != nil {
+			return nil, fmt.Errorf("failed to create zstd encoder: %w", err)
+		}
+		return enc.EncodeAll(data, out), nil
+	}
+	return append(out, data...), nil
+}
+
+// Unmarshal decodes data according to its format marker, regardless of the codec configuration,
+// so values written with another codec can still be read.
+func (c *Codec) Unmarshal(data []byte, out any) error {
+	if len(data) < headerSize || data[0] != magicByte {
+		return json.Unmarshal(data, out)
+	}
+
+	serialization := Serialization(data[1] >> 4)
+	compression := Compression(data[1] & 0x0f)
+	data = data[headerSize:]
+
+	switch compression {
+	case CompressionNone:
+	case CompressionGzip:
+		zr, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return fmt.Errorf("failed to gunzip value: %w", err)
+		}
+		defer zr.Close()
+		if data, err = io.ReadAll(zr); err != nil {
+			return fmt.Errorf("failed to gunzip value: %w", err)
+		}
+	case CompressionZstd:
+		dec, err := zstdDecoder()
+		if err != nil {
+			return fmt.Errorf("failed to create zstd decoder: %w", err)
+		}
+		if data, err = dec.DecodeAll(data, nil); err != nil {
+			return fmt.Errorf("failed to decompress zstd value: %w", err)
+		}
+	default:
+		return fmt.Errorf("unknown compression %d", compression)
+	}
+
+	return deserialize(serialization, data, out)
+}
+
+func serialize(s Serialization, v any) ([]byte, error) {
+	switch s {
+	case SerializationJSON:
+		return json.Marshal(v)
+	case SerializationMsgPack:
+		var buf bytes.Buffer
+		enc := msgpack.NewEncoder(&buf)
+		enc.SetCustomStructTag("json")
+		if err := enc.Encode(v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown serialization %d", s)
+}
+
+func deserialize(s Serialization, data []byte, out any) error {
+	switch s {
+	case SerializationJSON:
+		return json.Unmarshal(data, out)
+	case SerializationMsgPack:
+		dec := msgpack.NewDecoder(bytes.NewReader(data))
+		dec.SetCustomStructTag("json")
+		return dec.Decode(out)
+	}
+	return fmt.Errorf("unknown serialization %d", s)
+}
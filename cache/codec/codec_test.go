@@ -0,0 +1,76 @@
+package codec
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+)
+
+type value struct {
+	ID    int      `json:"id"`
+	Name  string   `json:"name"`
+	Lines []string `json:"lines"`
+}
+
+func TestCodec_RoundTrip(t *testing.T) {
+	t.Parallel()
+
+	val := value{ID: 7, Name: "item", Lines: []string{strings.Repeat("a", 2048), "b"}}
+
+	for _, s := range []string{"json", "msgpack"} {
+		for _, c := range []string{"none", "gzip", "zstd"} {
+			t.Run(s+"_"+c, func(t *testing.T) {
+				cd, err := Parse(s, c)
+				require.NoError(t, err)
+
+				data, err := cd.Marshal(val)
+				require.NoError(t, err)
+				require.Equal(t, magicByte, data[0])
+				require.Equal(t, byte(serializations[s])<<4|byte(compressions[c]), data[1])
+
+				var got value
+				require.NoError(t, cd.Unmarshal(data, &got))
+				require.Equal(t, val, got)
+
+				// a codec with a different configuration can still read the value
+				var gotDefault value
+				require.NoError(t, Default().Unmarshal(data, &gotDefault))
+				require.Equal(t, val, gotDefault)
+			})
+		}
+	}
+}
+
+func TestCodec_SmallValuesNotCompressed(t *testing.T) {
+	t.Parallel()
+
+	cd, err := New(SerializationJSON, CompressionZstd)
+	require.NoError(t, err)
+	data, err := cd.Marshal(value{ID: 1})
+	require.NoError(t, err)
+	require.Equal(t, byte(SerializationJSON)<<4|byte(CompressionNone), data[1])
+}
+
+func TestCodec_LegacyJSON(t *testing.T) {
+	t.Parallel()
+
+	val := value{ID: 3, Name: "legacy"}
+	data, err := json.Marshal(val)
+	require.NoError(t, err)
+
+	cd, err := New(SerializationMsgPack, CompressionGzip)
+	require.NoError(t, err)
+	var got value
+	require.NoError(t, cd.Unmarshal(data, &got))
+	require.Equal(t, val, got)
+}
+
+func TestParse_Invalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := Parse("xml", "")
+	require.Error(t, err)
+	_, err = Parse("", "lz4")
+	require.Error(t, err)
+}
@@ -0,0 +1,18 @@
+package invalidation
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+// Handler is called with the keys another instance asked to evict.
+type Handler func(ctx context.Context, keys []string)
+
+type Message struct {
+	Origin string   `json:"origin"`
+	Keys   []string `json:"keys"`
+}
+
+func newOrigin() string {
+	return uuid.NewString()
+}
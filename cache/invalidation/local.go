@@ -0,0 +1,62 @@
+package invalidation
+
+import (
+	"context"
+	"sync"
+)
+
+// Hub connects local buses in the same process, each bus acts as a separate server instance.
+type Hub struct {
+	mu    sync.RWMutex
+	buses []*LocalBus
+}
+
+func NewHub() *Hub {
+	return &Hub{}
+}
+
+func (h *Hub) NewBus() *LocalBus {
+	b := &LocalBus{hub: h, origin: newOrigin()}
+	h.mu.Lock()
+	h.buses = append(h.buses, b)
+	h.mu.Unlock()
+	return b
+}
+
+type LocalBus struct {
+	hub    *Hub
+	origin string
+
+	mu       sync.RWMutex
+	handlers []Handler
+}
+
+func (b *LocalBus) Publish(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	b.hub.mu.RLock()
+	defer b.hub.mu.RUnlock()
+	for _, peer := range b.hub.buses {
+		if peer.origin == b.origin {
+			continue
+		}
+		peer.deliver(ctx, keys)
+	}
+	return nil
+}
+
+func (b *LocalBus) Subscribe(_ context.Context, handler Handler) error {
+	b.mu.Lock()
+	b.handlers = append(b.handlers, handler)
+	b.mu.Unlock()
+	return nil
+}
+
+func (b *LocalBus) deliver(ctx context.Context, keys []string) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	for _, h := range b.handlers {
+		h(ctx, keys)
+	}
+}
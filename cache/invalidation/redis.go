@@ -0,0 +1,74 @@
+package invalidation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"github.com/redis/go-redis/v9"
+)
+
+const DefaultChannel = "di-demo:cache-invalidation"
+
+type RedisBus struct {
+	rdb     *redis.Client
+	channel string
+	origin  string
+}
+
+func NewRedisBus(rdb *redis.Client, channel string) *RedisBus {
+	if channel == "" {
+		channel = DefaultChannel
+	}
+	return &RedisBus{
+		rdb:     rdb,
+		channel: channel,
+		origin:  newOrigin(),
+	}
+}
+
+func (b *RedisBus) Publish(ctx context.Context, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(Message{Origin: b.origin, Keys: keys})
+	if err != nil {
+		return fmt.Errorf("failed to serialize invalidation message: %w", err)
+	}
+	return b.rdb.Publish(ctx, b.channel, data).Err()
+}
+
+// Subscribe starts delivering messages published by other instances to handler until ctx is done.
+func (b *RedisBus) Subscribe(ctx context.Context, handler Handler) error {
+	ps := b.rdb.Subscribe(ctx, b.channel)
+	if _, err := ps.Receive(ctx); err != nil {
+		_ = ps.Close()
+		return fmt.Errorf("failed to subscribe to %s: %w", b.channel, err)
+	}
+
+	go func() {
+		defer ps.Close()
+		ch := ps.Channel()
+		for {
+			select {
+			case msg, ok := <-ch:
+				if !ok {
+					return
+				}
+				var m Message
+				if err := json.Unmarshal([]byte(msg.Payload), &m); err != nil {
+					log.Errorf(ctx, "Failed to parse invalidation message: %v", err)
+					continue
+				}
+				if m.Origin == b.origin {
+					continue
+				}
+				handler(ctx, m.Keys)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return nil
+}
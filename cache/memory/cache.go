@@ -2,14 +2,26 @@ package memory
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/cache/codec"
+	"strings"
 	"sync"
 	"time"
 )
 
 type Cache struct {
 	storage sync.Map
+	codec   *codec.Codec
+}
+
+type Option func(c *Cache)
+
+func WithCodec(cd *codec.Codec) Option {
+	return func(c *Cache) {
+		c.codec = cd
+	}
 }
 
 type cacheItem struct {
@@ -17,8 +29,12 @@ type cacheItem struct {
 	expiration time.Time
 }
 
-func NewCache() *Cache {
-	return &Cache{}
+func NewCache(opts ...Option) *Cache {
+	c := &Cache{codec: codec.Default()}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *Cache) Get(_ context.Context, key string, out any) error {
@@ -27,20 +43,20 @@ func (c *Cache) Get(_ context.Context, key string, out any) error {
 	}
 	raw, ok := c.storage.Load(key)
 	if !ok {
-		return errors.New("key not found")
+		return fmt.Errorf("key not found: %w", cache.ErrCacheMiss)
 	}
 
 	item := raw.(cacheItem)
 	if !item.expiration.IsZero() && time.Now().After(item.expiration) {
 		c.storage.Delete(key)
-		return errors.New("key expired")
+		return fmt.Errorf("key expired: %w", cache.ErrCacheMiss)
 	}
-	
-	return json.Unmarshal(item.value, out)
+
+	return c.codec.Unmarshal(item.value, out)
 }
 
 func (c *Cache) Set(_ context.Context, key string, val any, ttl time.Duration) error {
-	data, err := json.Marshal(val)
+	data, err := c.codec.Marshal(val)
 	if err != nil {
 		return err
 	}
@@ -56,3 +72,15 @@ func (c *Cache) Delete(_ context.Context, key string) error {
 	c.storage.Delete(key)
 	return nil
 }
+
+func (c *Cache) DeletePrefix(_ context.Context, prefix string) (int, error) {
+	n := 0
+	c.storage.Range(func(key, _ any) bool {
+		if strings.HasPrefix(key.(string), prefix) {
+			c.storage.Delete(key)
+			n++
+		}
+		return true
+	})
+	return n, nil
+}
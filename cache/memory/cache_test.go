@@ -2,6 +2,8 @@ package memory
 
 import (
 	"context"
+	"errors"
+	"github.com/Av1shay/di-demo/cache"
 	"reflect"
 	"strings"
 	"testing"
@@ -39,6 +41,9 @@ func TestCache_Get(t *testing.T) {
 	if !strings.Contains(err.Error(), "key not found") {
 		t.Fatal("expected error to contain 'key not found'")
 	}
+	if !errors.Is(err, cache.ErrCacheMiss) {
+		t.Fatal("expected error to be cache miss")
+	}
 
 	if err := c.Set(ctx, key2, val2, time.Millisecond); err != nil {
 		t.Fatal(err)
@@ -53,4 +58,34 @@ func TestCache_Get(t *testing.T) {
 	if !strings.Contains(err.Error(), "key expired") {
 		t.Fatal("expected error to contain 'key expired'")
 	}
+	if !errors.Is(err, cache.ErrCacheMiss) {
+		t.Fatal("expected error to be cache miss")
+	}
+}
+
+func TestCache_DeletePrefix(t *testing.T) {
+	ctx := context.Background()
+	c := NewCache()
+	for _, key := range []string{"item:acc-1:a", "item:acc-1:b", "item:acc-2:a", "list:acc-1:x"} {
+		if err := c.Set(ctx, key, cacheVal{ID: 1}, time.Minute); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := c.DeletePrefix(ctx, "item:acc-1:")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Fatalf("expected 2 deleted keys, got %d", n)
+	}
+	var out cacheVal
+	if err := c.Get(ctx, "item:acc-1:a", &out); !errors.Is(err, cache.ErrCacheMiss) {
+		t.Fatalf("expected cache miss, got %v", err)
+	}
+	for _, key := range []string{"item:acc-2:a", "list:acc-1:x"} {
+		if err := c.Get(ctx, key, &out); err != nil {
+			t.Fatalf("expected %s to be kept, got %v", key, err)
+		}
+	}
 }
@@ -0,0 +1,29 @@
+package cache
+
+import (
+	"context"
+	"time"
+)
+
+// Noop is a cache that stores nothing, every Get is a miss.
+type Noop struct{}
+
+func NewNoop() *Noop {
+	return &Noop{}
+}
+
+func (n *Noop) Get(_ context.Context, _ string, _ any) error {
+	return ErrCacheMiss
+}
+
+func (n *Noop) Set(_ context.Context, _ string, _ any, _ time.Duration) error {
+	return nil
+}
+
+func (n *Noop) Delete(_ context.Context, _ string) error {
+	return nil
+}
+
+func (n *Noop) DeletePrefix(_ context.Context, _ string) (int, error) {
+	return 0, nil
+}
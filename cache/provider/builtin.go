@@ -0,0 +1,83 @@
+package provider
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/cache/memory"
+	"github.com/Av1shay/di-demo/cache/redis"
+	"github.com/Av1shay/di-demo/pkg/log"
+	redissdk "github.com/redis/go-redis/v9"
+	"slices"
+	"strconv"
+	"time"
+)
+
+func newMemory(_ context.Context, opts Options) (cache.Cache, func() error, error) {
+	if err := checkParams(opts.Params); err != nil {
+		return nil, nil, err
+	}
+	return memory.NewCache(memory.WithCodec(opts.Codec)), noopClose, nil
+}
+
+func newNone(_ context.Context, _ Options) (cache.Cache, func() error, error) {
+	return cache.NewNoop(), noopClose, nil
+}
+
+func newRedis(ctx context.Context, opts Options) (cache.Cache, func() error, error) {
+	if opts.RedisAddr == "" {
+		return nil, nil, errors.New("redis address is required")
+	}
+	redisOpts := &redissdk.Options{
+		Addr:     opts.RedisAddr,
+		Password: opts.RedisPassword,
+		// stop waiting for redis when the request deadline passes, the read and write timeouts still apply
+		ContextTimeoutEnabled: true,
+	}
+	if err := checkParams(opts.Params, "db", "pool_size", "dial_timeout", "read_timeout", "write_timeout"); err != nil {
+		return nil, nil, err
+	}
+	var err error
+	if v, ok := opts.Params["db"]; ok {
+		if redisOpts.DB, err = strconv.Atoi(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid redis db %q: %w", v, err)
+		}
+	}
+	if v, ok := opts.Params["pool_size"]; ok {
+		if redisOpts.PoolSize, err = strconv.Atoi(v); err != nil {
+			return nil, nil, fmt.Errorf("invalid redis pool_size %q: %w", v, err)
+		}
+	}
+	for param, dst := range map[string]*time.Duration{
+		"dial_timeout":  &redisOpts.DialTimeout,
+		"read_timeout":  &redisOpts.ReadTimeout,
+		"write_timeout": &redisOpts.WriteTimeout,
+	} {
+		if v, ok := opts.Params[param]; ok {
+			if *dst, err = time.ParseDuration(v); err != nil {
+				return nil, nil, fmt.Errorf("invalid redis %s %q: %w", param, v, err)
+			}
+		}
+	}
+
+	rdb := redissdk.NewClient(redisOpts)
+	if err := rdb.Ping(ctx).Err(); err != nil {
+		log.Errorf(ctx, "Failed to ping Redis: %v", err)
+	}
+
+	redisCacheOpts := []redis.Option{redis.WithCodec(opts.Codec)}
+	if opts.KeyPrefix != "" {
+		redisCacheOpts = append(redisCacheOpts, redis.WithKeyPrefix(opts.KeyPrefix))
+	}
+	return redis.NewCache(rdb, redisCacheOpts...), rdb.Close, nil
+}
+
+func checkParams(params map[string]string, allowed ...string) error {
+	for k := range params {
+		if !slices.Contains(allowed, k) {
+			return fmt.Errorf("unknown cache provider option %q", k)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,78 @@
+package provider
+
+import (
+	"context"
+	"fmt"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/cache/codec"
+	"slices"
+	"sync"
+)
+
+const (
+	Memory = "memory"
+	Redis  = "redis"
+	None   = "none"
+)
+
+type Options struct {
+	KeyPrefix     string
+	Codec         *codec.Codec
+	RedisAddr     string
+	RedisPassword string
+	// Params holds provider specific settings, e.g. the redis db number.
+	Params map[string]string
+}
+
+// Factory creates a cache and a function releasing its resources.
+type Factory func(ctx context.Context, opts Options) (cache.Cache, func() error, error)
+
+var (
+	mu        sync.RWMutex
+	factories = map[string]Factory{
+		Memory: newMemory,
+		Redis:  newRedis,
+		None:   newNone,
+	}
+)
+
+func Register(name string, factory Factory) {
+	mu.Lock()
+	defer mu.Unlock()
+	factories[name] = factory
+}
+
+func Registered(name string) bool {
+	mu.RLock()
+	defer mu.RUnlock()
+	_, ok := factories[name]
+	return ok
+}
+
+func Names() []string {
+	mu.RLock()
+	defer mu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	return names
+}
+
+func New(ctx context.Context, name string, opts Options) (cache.Cache, func() error, error) {
+	mu.RLock()
+	factory, ok := factories[name]
+	mu.RUnlock()
+	if !ok {
+		return nil, nil, fmt.Errorf("unknown cache provider %q, valid values: %+v", name, Names())
+	}
+	if opts.Codec == nil {
+		opts.Codec = codec.Default()
+	}
+	return factory(ctx, opts)
+}
+
+func noopClose() error {
+	return nil
+}
@@ -0,0 +1,46 @@
+package provider
+
+import (
+	"context"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/cache/memory"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestNew(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	c, closeFn, err := New(ctx, Memory, Options{})
+	require.NoError(t, err)
+	require.IsType(t, &memory.Cache{}, c)
+	require.NoError(t, closeFn())
+
+	c, _, err = New(ctx, None, Options{})
+	require.NoError(t, err)
+	require.NoError(t, c.Set(ctx, "k", "v", time.Minute))
+	var out string
+	require.ErrorIs(t, c.Get(ctx, "k", &out), cache.ErrCacheMiss)
+
+	_, _, err = New(ctx, "memcached", Options{})
+	require.ErrorContains(t, err, "unknown cache provider")
+
+	_, _, err = New(ctx, Memory, Options{Params: map[string]string{"db": "1"}})
+	require.ErrorContains(t, err, "unknown cache provider option")
+
+	_, _, err = New(ctx, Redis, Options{RedisAddr: "localhost:6379", Params: map[string]string{"db": "x"}})
+	require.ErrorContains(t, err, "invalid redis db")
+}
+
+func TestRegister(t *testing.T) {
+	t.Parallel()
+
+	Register("test-provider", func(_ context.Context, _ Options) (cache.Cache, func() error, error) {
+		return cache.NewNoop(), noopClose, nil
+	})
+	require.True(t, Registered("test-provider"))
+	require.Contains(t, Names(), "test-provider")
+}
@@ -2,48 +2,115 @@ package redis
 
 import (
 	"context"
-	"encoding/json"
 	"errors"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/cache/codec"
 	"github.com/redis/go-redis/v9"
+	"strings"
 	"time"
 )
 
-const keyPrefix = "di-demo:"
+const (
+	DefaultKeyPrefix = "di-demo:"
+	scanBatchSize    = 500
+)
+
+// globEscaper escapes the characters with a meaning in SCAN MATCH patterns.
+var globEscaper = strings.NewReplacer(`\`, `\\`, "*", `\*`, "?", `\?`, "[", `\[`, "]", `\]`)
 
 type Cache struct {
-	rdb *redis.Client
+	rdb       *redis.Client
+	codec     *codec.Codec
+	keyPrefix string
 }
 
-func NewCache(rdb *redis.Client) *Cache {
-	return &Cache{rdb: rdb}
+type Option func(c *Cache)
+
+func WithCodec(cd *codec.Codec) Option {
+	return func(c *Cache) {
+		c.codec = cd
+	}
+}
+
+func WithKeyPrefix(prefix string) Option {
+	return func(c *Cache) {
+		c.keyPrefix = prefix
+	}
+}
+
+func NewCache(rdb *redis.Client, opts ...Option) *Cache {
+	c := &Cache{rdb: rdb, codec: codec.Default(), keyPrefix: DefaultKeyPrefix}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
 }
 
 func (c *Cache) Get(ctx context.Context, key string, out any) error {
 	if out == nil {
 		return errors.New("empty output destination provided")
 	}
-	key = BuildKey(key)
+	key = c.keyPrefix + key
 	res, err := c.rdb.Get(ctx, key).Bytes()
 	if err != nil {
+		if errors.Is(err, redis.Nil) {
+			return cache.ErrCacheMiss
+		}
 		return err
 	}
-	return json.Unmarshal(res, &out)
+	return c.codec.Unmarshal(res, out)
 }
 
 func (c *Cache) Set(ctx context.Context, key string, val any, ttl time.Duration) error {
-	data, err := json.Marshal(val)
+	data, err := c.codec.Marshal(val)
 	if err != nil {
 		return err
 	}
-	key = BuildKey(key)
+	key = c.keyPrefix + key
 	return c.rdb.Set(ctx, key, data, ttl).Err()
 }
 
 func (c *Cache) Delete(ctx context.Context, key string) error {
-	key = BuildKey(key)
+	key = c.keyPrefix + key
 	return c.rdb.Del(ctx, key).Err()
 }
 
+// DeletePrefix scans the keys starting with prefix and deletes them in batches, keys set while scanning may be kept.
+func (c *Cache) DeletePrefix(ctx context.Context, prefix string) (int, error) {
+	iter := c.rdb.Scan(ctx, 0, globEscaper.Replace(c.keyPrefix+prefix)+"*", scanBatchSize).Iterator()
+	n := 0
+	batch := make([]string, 0, scanBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		deleted, err := c.rdb.Del(ctx, batch...).Result()
+		if err != nil {
+			return err
+		}
+		n += int(deleted)
+		batch = batch[:0]
+		return nil
+	}
+	for iter.Next(ctx) {
+		batch = append(batch, iter.Val())
+		if len(batch) == scanBatchSize {
+			if err := flush(); err != nil {
+				return n, err
+			}
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return n, err
+	}
+	return n, flush()
+}
+
+func (c *Cache) Ping(ctx context.Context) error {
+	return c.rdb.Ping(ctx).Err()
+}
+
+// BuildKey returns the redis key for v with the default key prefix.
 func BuildKey(v string) string {
-	return keyPrefix + v
+	return DefaultKeyPrefix + v
 }
@@ -3,10 +3,23 @@ package config
 import (
 	"errors"
 	"fmt"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/cache/codec"
+	"github.com/Av1shay/di-demo/cache/provider"
+	"github.com/Av1shay/di-demo/ratelimit"
 	"github.com/Av1shay/di-demo/uam"
 	"os"
 	"slices"
 	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultHTTPReadTimeout  = 10 * time.Second
+	defaultHTTPWriteTimeout = 30 * time.Second
+	defaultHTTPIdleTimeout  = 2 * time.Minute
+	defaultShutdownTimeout  = 30 * time.Second
 )
 
 type Manager struct {
@@ -18,6 +31,67 @@ type Manager struct {
 	cacheEnabled  bool
 	redisAddr     string
 	redisPassword string
+
+	cacheSerialization string
+	cacheCompression   string
+	cacheCodec         *codec.Codec
+
+	cacheItemTTL   time.Duration
+	cacheListTTL   time.Duration
+	cacheKeyPrefix string
+	cacheOptions   string
+	cacheParams    map[string]string
+
+	cacheInvalidationEnabled bool
+
+	cacheWarmUpEnabled         bool
+	cacheWarmUpItemsPerAccount int
+	cacheWarmUpMaxItems        int
+	cacheWarmUpTimeout         time.Duration
+
+	cacheBreakerThreshold int
+	cacheBreakerCooldown  time.Duration
+
+	openAPIValidationEnabled bool
+
+	rateLimitBackend RateLimitBackend
+	rateLimitsStr    string
+	rateLimits       map[string]ratelimit.Limit
+
+	idempotencyEnabled bool
+	idempotencyTTL     time.Duration
+
+	eventsBacklogSize int
+
+	apiRootDeprecatedAtStr string
+	apiRootSunsetStr       string
+	apiRootDeprecatedAt    time.Time
+	apiRootSunset          time.Time
+
+	corsAllowedOrigins   []string
+	corsAllowedMethods   []string
+	corsAllowedHeaders   []string
+	corsAllowCredentials bool
+	corsMaxAge           time.Duration
+
+	httpReadTimeout  time.Duration
+	httpWriteTimeout time.Duration
+	httpIdleTimeout  time.Duration
+	httpMaxBodySize  int64
+	importMaxSize    int64
+	shutdownTimeout  time.Duration
+	shutdownDelay    time.Duration
+
+	healthCheckInterval time.Duration
+	healthCheckTimeout  time.Duration
+
+	adminToken string
+
+	requestTimeoutsStr string
+	requestTimeouts    map[string]time.Duration
+
+	accessLogExcludePaths  []string
+	accessLogSlowThreshold time.Duration
 }
 
 func NewManager() *Manager {
@@ -27,9 +101,54 @@ func NewManager() *Manager {
 	m.mongoURI = os.Getenv("MONGO_URI")
 	m.mongoDB = os.Getenv("MONGO_DB")
 	m.cacheProvider = CacheProvider(os.Getenv("CACHE_PROVIDER"))
+	if m.cacheProvider == "" {
+		m.cacheProvider = CacheProviderMemory
+	}
 	m.cacheEnabled, _ = strconv.ParseBool(os.Getenv("CACHE_ENABLED"))
 	m.redisAddr = os.Getenv("REDIS_ADDR")
 	m.redisPassword = os.Getenv("REDIS_PASSWORD")
+	m.cacheSerialization = os.Getenv("CACHE_SERIALIZATION")
+	m.cacheCompression = os.Getenv("CACHE_COMPRESSION")
+	m.cacheItemTTL, _ = time.ParseDuration(os.Getenv("CACHE_ITEM_TTL"))
+	m.cacheListTTL, _ = time.ParseDuration(os.Getenv("CACHE_LIST_TTL"))
+	m.cacheKeyPrefix = os.Getenv("CACHE_KEY_PREFIX")
+	m.cacheOptions = os.Getenv("CACHE_OPTIONS")
+	m.cacheInvalidationEnabled, _ = strconv.ParseBool(os.Getenv("CACHE_INVALIDATION_ENABLED"))
+	m.cacheWarmUpEnabled, _ = strconv.ParseBool(os.Getenv("CACHE_WARMUP_ENABLED"))
+	m.cacheWarmUpItemsPerAccount, _ = strconv.Atoi(os.Getenv("CACHE_WARMUP_ITEMS_PER_ACCOUNT"))
+	m.cacheWarmUpMaxItems, _ = strconv.Atoi(os.Getenv("CACHE_WARMUP_MAX_ITEMS"))
+	m.cacheWarmUpTimeout, _ = time.ParseDuration(os.Getenv("CACHE_WARMUP_TIMEOUT"))
+	m.cacheBreakerThreshold, _ = strconv.Atoi(os.Getenv("CACHE_BREAKER_THRESHOLD"))
+	m.cacheBreakerCooldown, _ = time.ParseDuration(os.Getenv("CACHE_BREAKER_COOLDOWN"))
+	m.openAPIValidationEnabled, _ = strconv.ParseBool(os.Getenv("OPENAPI_VALIDATION_ENABLED"))
+	m.rateLimitBackend = RateLimitBackend(os.Getenv("RATE_LIMIT_BACKEND"))
+	if m.rateLimitBackend == "" {
+		m.rateLimitBackend = RateLimitBackendNone
+	}
+	m.rateLimitsStr = os.Getenv("RATE_LIMITS")
+	m.idempotencyEnabled, _ = strconv.ParseBool(os.Getenv("IDEMPOTENCY_ENABLED"))
+	m.idempotencyTTL, _ = time.ParseDuration(os.Getenv("IDEMPOTENCY_TTL"))
+	m.eventsBacklogSize, _ = strconv.Atoi(os.Getenv("EVENTS_BACKLOG_SIZE"))
+	m.apiRootDeprecatedAtStr = os.Getenv("API_ROOT_DEPRECATED_AT")
+	m.apiRootSunsetStr = os.Getenv("API_ROOT_SUNSET")
+	m.corsAllowedOrigins = listEnv("CORS_ALLOWED_ORIGINS")
+	m.corsAllowedMethods = listEnv("CORS_ALLOWED_METHODS")
+	m.corsAllowedHeaders = listEnv("CORS_ALLOWED_HEADERS")
+	m.corsAllowCredentials, _ = strconv.ParseBool(os.Getenv("CORS_ALLOW_CREDENTIALS"))
+	m.corsMaxAge, _ = time.ParseDuration(os.Getenv("CORS_MAX_AGE"))
+	m.httpReadTimeout = durationEnv("HTTP_READ_TIMEOUT", defaultHTTPReadTimeout)
+	m.httpWriteTimeout = durationEnv("HTTP_WRITE_TIMEOUT", defaultHTTPWriteTimeout)
+	m.httpIdleTimeout = durationEnv("HTTP_IDLE_TIMEOUT", defaultHTTPIdleTimeout)
+	m.httpMaxBodySize, _ = strconv.ParseInt(os.Getenv("HTTP_MAX_BODY_SIZE"), 10, 64)
+	m.importMaxSize, _ = strconv.ParseInt(os.Getenv("IMPORT_MAX_SIZE"), 10, 64)
+	m.shutdownTimeout = durationEnv("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+	m.shutdownDelay, _ = time.ParseDuration(os.Getenv("SHUTDOWN_DELAY"))
+	m.healthCheckInterval, _ = time.ParseDuration(os.Getenv("HEALTH_CHECK_INTERVAL"))
+	m.healthCheckTimeout, _ = time.ParseDuration(os.Getenv("HEALTH_CHECK_TIMEOUT"))
+	m.adminToken = os.Getenv("ADMIN_TOKEN")
+	m.requestTimeoutsStr = os.Getenv("REQUEST_TIMEOUTS")
+	m.accessLogExcludePaths = listEnv("ACCESS_LOG_EXCLUDE_PATHS")
+	m.accessLogSlowThreshold, _ = time.ParseDuration(os.Getenv("ACCESS_LOG_SLOW_THRESHOLD"))
 	return m
 }
 
@@ -43,12 +162,55 @@ func (m *Manager) Validate() error {
 	if m.datasource == DataSourceMongo && (m.mongoURI == "" || m.mongoDB == "") {
 		return errors.New("mongo uri and db name are required")
 	}
-	if !slices.Contains(allCacheProviders, m.cacheProvider) {
-		return fmt.Errorf("invalid cache providor provided %q, vlid values: %+v", m.cacheProvider, allCacheProviders)
+	if !provider.Registered(string(m.cacheProvider)) {
+		return fmt.Errorf("invalid cache providor provided %q, vlid values: %+v", m.cacheProvider, provider.Names())
 	}
-	if m.cacheProvider == CacheProviderRedis && m.redisAddr == "" {
+	if (m.cacheProvider == CacheProviderRedis || m.cacheInvalidationEnabled) && m.redisAddr == "" {
 		return errors.New("redis address is required")
 	}
+	cacheCodec, err := codec.Parse(m.cacheSerialization, m.cacheCompression)
+	if err != nil {
+		return fmt.Errorf("invalid cache codec: %w", err)
+	}
+	m.cacheCodec = cacheCodec
+	cacheParams, err := parseKeyValues(m.cacheOptions)
+	if err != nil {
+		return fmt.Errorf("invalid cache options: %w", err)
+	}
+	m.cacheParams = cacheParams
+	if !slices.Contains(allRateLimitBackends, m.rateLimitBackend) {
+		return fmt.Errorf("invalid rate limit backend provided %q, vlid values: %+v", m.rateLimitBackend, allRateLimitBackends)
+	}
+	if m.rateLimitBackend == RateLimitBackendRedis && m.redisAddr == "" {
+		return errors.New("redis address is required")
+	}
+	rateLimits, err := parseRateLimits(m.rateLimitsStr)
+	if err != nil {
+		return fmt.Errorf("invalid rate limits: %w", err)
+	}
+	m.rateLimits = rateLimits
+	if m.idempotencyEnabled && m.cacheProvider == CacheProviderNone {
+		return errors.New("idempotency keys require a cache provider")
+	}
+	if m.corsAllowCredentials && slices.Contains(m.corsAllowedOrigins, "*") {
+		return errors.New("cors credentials can't be allowed for any origin, list the allowed origins instead of *")
+	}
+	requestTimeouts, err := parseDurations(m.requestTimeoutsStr)
+	if err != nil {
+		return fmt.Errorf("invalid request timeouts: %w", err)
+	}
+	for group := range requestTimeouts {
+		if !slices.Contains(allRequestTimeoutGroups, group) {
+			return fmt.Errorf("invalid request timeouts: unknown route group %q, valid values: %+v", group, allRequestTimeoutGroups)
+		}
+	}
+	m.requestTimeouts = requestTimeouts
+	if m.apiRootDeprecatedAt, err = parseDate(m.apiRootDeprecatedAtStr); err != nil {
+		return fmt.Errorf("invalid api root deprecation date: %w", err)
+	}
+	if m.apiRootSunset, err = parseDate(m.apiRootSunsetStr); err != nil {
+		return fmt.Errorf("invalid api root sunset date: %w", err)
+	}
 	return nil
 }
 
@@ -76,6 +238,10 @@ func (m *Manager) CacheProvider() CacheProvider {
 	return m.cacheProvider
 }
 
+func (m *Manager) CacheInvalidationEnabled() bool {
+	return m.cacheInvalidationEnabled
+}
+
 func (m *Manager) RedisAddr() string {
 	return m.redisAddr
 }
@@ -84,8 +250,257 @@ func (m *Manager) RedisPassword() string {
 	return m.redisPassword
 }
 
+// CacheCodec returns the codec for cache values, it is set by Validate.
+func (m *Manager) CacheCodec() *codec.Codec {
+	if m.cacheCodec == nil {
+		return codec.Default()
+	}
+	return m.cacheCodec
+}
+
+func (m *Manager) CacheProviderOptions() provider.Options {
+	return provider.Options{
+		KeyPrefix:     m.cacheKeyPrefix,
+		Codec:         m.CacheCodec(),
+		RedisAddr:     m.redisAddr,
+		RedisPassword: m.redisPassword,
+		Params:        m.cacheParams,
+	}
+}
+
+func (m *Manager) CacheWarmUpEnabled() bool {
+	return m.cacheWarmUpEnabled
+}
+
+func (m *Manager) CacheWarmUpOptions() uam.WarmUpOptions {
+	return uam.WarmUpOptions{
+		ItemsPerAccount: m.cacheWarmUpItemsPerAccount,
+		MaxItems:        m.cacheWarmUpMaxItems,
+		Timeout:         m.cacheWarmUpTimeout,
+	}
+}
+
+func (m *Manager) CacheBreakerConfig() cache.BreakerConfig {
+	return cache.BreakerConfig{
+		FailureThreshold: m.cacheBreakerThreshold,
+		Cooldown:         m.cacheBreakerCooldown,
+	}
+}
+
+func (m *Manager) OpenAPIValidationEnabled() bool {
+	return m.openAPIValidationEnabled
+}
+
+func (m *Manager) RateLimitBackend() RateLimitBackend {
+	return m.rateLimitBackend
+}
+
+// RateLimits returns the limit of every route group, it is set by Validate.
+func (m *Manager) RateLimits() map[string]ratelimit.Limit {
+	return m.rateLimits
+}
+
+func (m *Manager) IdempotencyEnabled() bool {
+	return m.idempotencyEnabled
+}
+
+// IdempotencyTTL is how long the responses of requests with an idempotency key are replayed.
+func (m *Manager) IdempotencyTTL() time.Duration {
+	return m.idempotencyTTL
+}
+
+// EventsBacklogSize is the number of latest item events kept for resuming watchers, zero for the broker default.
+func (m *Manager) EventsBacklogSize() int {
+	return m.eventsBacklogSize
+}
+
+// APIRootDeprecation returns when the unversioned root routes were deprecated and when they will be removed,
+// zero times for the server defaults. They are set by Validate.
+func (m *Manager) APIRootDeprecation() (deprecatedAt, sunset time.Time) {
+	return m.apiRootDeprecatedAt, m.apiRootSunset
+}
+
+// CORSEnabled reports whether any cross-origin requests are allowed.
+func (m *Manager) CORSEnabled() bool {
+	return len(m.corsAllowedOrigins) > 0
+}
+
+// CORSAllowedOrigins are the origins allowed to make cross-origin requests, "*" allows any origin.
+func (m *Manager) CORSAllowedOrigins() []string {
+	return m.corsAllowedOrigins
+}
+
+// CORSAllowedMethods are the methods allowed in cross-origin requests, empty for the server default.
+func (m *Manager) CORSAllowedMethods() []string {
+	return m.corsAllowedMethods
+}
+
+// CORSAllowedHeaders are the request headers allowed in cross-origin requests, empty for the server default.
+func (m *Manager) CORSAllowedHeaders() []string {
+	return m.corsAllowedHeaders
+}
+
+func (m *Manager) CORSAllowCredentials() bool {
+	return m.corsAllowCredentials
+}
+
+// CORSMaxAge is how long browsers may cache preflight responses, zero leaves it to the browser.
+func (m *Manager) CORSMaxAge() time.Duration {
+	return m.corsMaxAge
+}
+
+func (m *Manager) HTTPReadTimeout() time.Duration {
+	return m.httpReadTimeout
+}
+
+func (m *Manager) HTTPWriteTimeout() time.Duration {
+	return m.httpWriteTimeout
+}
+
+func (m *Manager) HTTPIdleTimeout() time.Duration {
+	return m.httpIdleTimeout
+}
+
+// HTTPMaxBodySize is the max size of request bodies in bytes, zero for the server default.
+func (m *Manager) HTTPMaxBodySize() int64 {
+	return m.httpMaxBodySize
+}
+
+// ImportMaxSize is the max size of uploaded import files in bytes, zero for the server default.
+func (m *Manager) ImportMaxSize() int64 {
+	return m.importMaxSize
+}
+
+// ShutdownTimeout is the time in-flight requests have to complete, and dependencies to close, on shutdown.
+func (m *Manager) ShutdownTimeout() time.Duration {
+	return m.shutdownTimeout
+}
+
+// ShutdownDelay is the time between failing the readiness check and draining requests on shutdown.
+func (m *Manager) ShutdownDelay() time.Duration {
+	return m.shutdownDelay
+}
+
+// HealthCheckInterval is how often the dependencies are checked, zero for the server default.
+func (m *Manager) HealthCheckInterval() time.Duration {
+	return m.healthCheckInterval
+}
+
+// HealthCheckTimeout is the time every dependency check has to complete, zero for the server default.
+func (m *Manager) HealthCheckTimeout() time.Duration {
+	return m.healthCheckTimeout
+}
+
+// RequestTimeouts returns the time budget of every route group that overrides the server default, zero for no limit.
+// It is set by Validate.
+func (m *Manager) RequestTimeouts() map[string]time.Duration {
+	return m.requestTimeouts
+}
+
+// AccessLogExcludePaths are the request paths that are not logged, a trailing * matches a prefix.
+func (m *Manager) AccessLogExcludePaths() []string {
+	return m.accessLogExcludePaths
+}
+
+// AccessLogSlowThreshold is the latency above which requests are logged as warnings, zero for never.
+func (m *Manager) AccessLogSlowThreshold() time.Duration {
+	return m.accessLogSlowThreshold
+}
+
+// AdminToken is the bearer token of the admin routes, they are not mounted when it is empty.
+func (m *Manager) AdminToken() string {
+	return m.adminToken
+}
+
 func (m *Manager) UAMAPIConfig() uam.Config {
 	return uam.Config{
-		CacheEnabled: m.CacheEnabled(),
+		CacheEnabled: m.CacheEnabled() && m.cacheProvider != CacheProviderNone,
+		ItemCacheTTL: m.cacheItemTTL,
+		ListCacheTTL: m.cacheListTTL,
+	}
+}
+
+// parseKeyValues parses comma separated key=value pairs, e.g. "db=1,pool_size=10".
+func parseKeyValues(s string) (map[string]string, error) {
+	res := make(map[string]string)
+	for _, pair := range strings.Split(s, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		k, v, ok := strings.Cut(pair, "=")
+		if !ok || strings.TrimSpace(k) == "" {
+			return nil, fmt.Errorf("invalid key value pair %q", pair)
+		}
+		res[strings.TrimSpace(k)] = strings.TrimSpace(v)
+	}
+	return res, nil
+}
+
+// parseRateLimits parses comma separated group=limit pairs of the known route groups, e.g. "read=100/1m,write=10/s:20".
+func parseRateLimits(s string) (map[string]ratelimit.Limit, error) {
+	pairs, err := parseKeyValues(s)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]ratelimit.Limit, len(pairs))
+	for group, v := range pairs {
+		if !slices.Contains(allRateLimitGroups, group) {
+			return nil, fmt.Errorf("unknown route group %q, valid values: %+v", group, allRateLimitGroups)
+		}
+		l, err := ratelimit.ParseLimit(v)
+		if err != nil {
+			return nil, fmt.Errorf("group %s: %w", group, err)
+		}
+		res[group] = l
+	}
+	return res, nil
+}
+
+// parseDurations parses comma separated key=duration pairs, e.g. "read=5s,import=0".
+func parseDurations(s string) (map[string]time.Duration, error) {
+	pairs, err := parseKeyValues(s)
+	if err != nil {
+		return nil, err
+	}
+	res := make(map[string]time.Duration, len(pairs))
+	for k, v := range pairs {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", k, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("%s: negative duration %s", k, v)
+		}
+		res[k] = d
+	}
+	return res, nil
+}
+
+// parseDate parses a date in the 2006-01-02 format, an empty string is the zero time.
+func parseDate(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.DateOnly, s)
+}
+
+// listEnv splits the comma separated values in the env variable key, empty values are dropped.
+func listEnv(key string) []string {
+	var res []string
+	for _, v := range strings.Split(os.Getenv(key), ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+// durationEnv parses the duration in the env variable key, it returns def when the variable is not set or invalid.
+func durationEnv(key string, def time.Duration) time.Duration {
+	d, err := time.ParseDuration(os.Getenv(key))
+	if err != nil || d <= 0 {
+		return def
 	}
+	return d
 }
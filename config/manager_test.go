@@ -0,0 +1,63 @@
+package config
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestManager_Validate(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		env     map[string]string
+		wantErr string
+	}{
+		{
+			name: "valid",
+			env: map[string]string{
+				"CORS_ALLOWED_ORIGINS":   "https://admin.example.com",
+				"CORS_ALLOW_CREDENTIALS": "true",
+			},
+		},
+		{
+			name: "cors_credentials_any_origin",
+			env: map[string]string{
+				"CORS_ALLOWED_ORIGINS":   "https://admin.example.com,*",
+				"CORS_ALLOW_CREDENTIALS": "true",
+			},
+			wantErr: "cors credentials can't be allowed for any origin",
+		},
+		{
+			name: "rate_limits",
+			env:  map[string]string{"RATE_LIMITS": "public=10/s:20,read=100/1m,write=30/1m"},
+		},
+		{
+			name:    "rate_limits_unknown_group",
+			env:     map[string]string{"RATE_LIMITS": "read=100/1m,writes=10/s"},
+			wantErr: `invalid rate limits: unknown route group "writes"`,
+		},
+		{
+			name: "request_timeouts",
+			env:  map[string]string{"REQUEST_TIMEOUTS": "read=5s,write=10s,import=0"},
+		},
+		{
+			name:    "request_timeouts_unknown_group",
+			env:     map[string]string{"REQUEST_TIMEOUTS": "read=5s,wirte=10s"},
+			wantErr: `unknown route group "wirte"`,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("DATA_SOURCE", string(DataSourceMongo))
+			t.Setenv("MONGO_URI", "mongodb://localhost:27017")
+			t.Setenv("MONGO_DB", "di-demo")
+			for k, v := range tt.env {
+				t.Setenv(k, v)
+			}
+			err := NewManager().Validate()
+			if tt.wantErr == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.ErrorContains(t, err, tt.wantErr)
+		})
+	}
+}
@@ -1,5 +1,7 @@
 package config
 
+import "github.com/Av1shay/di-demo/cache/provider"
+
 type DataSource string
 
 const (
@@ -9,10 +11,27 @@ const (
 
 var allDataSources = []DataSource{DataSourceMySQL, DataSourceMongo}
 
+// CacheProvider is the name of a cache registered in the cache/provider registry.
 type CacheProvider string
 
 const (
-	CacheProviderRedis CacheProvider = "redis"
+	CacheProviderMemory CacheProvider = provider.Memory
+	CacheProviderRedis  CacheProvider = provider.Redis
+	CacheProviderNone   CacheProvider = provider.None
 )
 
-var allCacheProviders = []CacheProvider{CacheProviderRedis}
+type RateLimitBackend string
+
+const (
+	RateLimitBackendNone   RateLimitBackend = "none"
+	RateLimitBackendMemory RateLimitBackend = "memory"
+	RateLimitBackendRedis  RateLimitBackend = "redis"
+)
+
+var allRateLimitBackends = []RateLimitBackend{RateLimitBackendNone, RateLimitBackendMemory, RateLimitBackendRedis}
+
+// allRateLimitGroups are the route groups of the server that have a rate limit.
+var allRateLimitGroups = []string{"public", "read", "write"}
+
+// allRequestTimeoutGroups are the route groups of the server that have a timeout.
+var allRequestTimeoutGroups = []string{"read", "write", "import"}
@@ -0,0 +1,121 @@
+package config
+
+import (
+	"github.com/go-sql-driver/mysql"
+	"net/url"
+	"strings"
+)
+
+const redacted = "[REDACTED]"
+
+// secretParamKeys are the parts of the names of provider params that hold secrets.
+var secretParamKeys = []string{"password", "secret", "token"}
+
+// RedactedConfig returns the effective configuration by env variable name, with the secrets replaced.
+func (m *Manager) RedactedConfig() map[string]any {
+	deprecatedAt, sunset := m.APIRootDeprecation()
+	return map[string]any{
+		"DATA_SOURCE":                    m.datasource,
+		"MYSQL_CONNECTION":               redactMySQLConn(m.mysqlConn),
+		"MONGO_URI":                      redactURL(m.mongoURI),
+		"MONGO_DB":                       m.mongoDB,
+		"CACHE_ENABLED":                  m.cacheEnabled,
+		"CACHE_PROVIDER":                 m.cacheProvider,
+		"REDIS_ADDR":                     m.redisAddr,
+		"REDIS_PASSWORD":                 redactSecret(m.redisPassword),
+		"CACHE_SERIALIZATION":            m.cacheSerialization,
+		"CACHE_COMPRESSION":              m.cacheCompression,
+		"CACHE_ITEM_TTL":                 m.cacheItemTTL.String(),
+		"CACHE_LIST_TTL":                 m.cacheListTTL.String(),
+		"CACHE_KEY_PREFIX":               m.cacheKeyPrefix,
+		"CACHE_OPTIONS":                  redactParams(m.cacheParams),
+		"CACHE_INVALIDATION_ENABLED":     m.cacheInvalidationEnabled,
+		"CACHE_WARMUP_ENABLED":           m.cacheWarmUpEnabled,
+		"CACHE_WARMUP_ITEMS_PER_ACCOUNT": m.cacheWarmUpItemsPerAccount,
+		"CACHE_WARMUP_MAX_ITEMS":         m.cacheWarmUpMaxItems,
+		"CACHE_WARMUP_TIMEOUT":           m.cacheWarmUpTimeout.String(),
+		"CACHE_BREAKER_THRESHOLD":        m.cacheBreakerThreshold,
+		"CACHE_BREAKER_COOLDOWN":         m.cacheBreakerCooldown.String(),
+		"OPENAPI_VALIDATION_ENABLED":     m.openAPIValidationEnabled,
+		"RATE_LIMIT_BACKEND":             m.rateLimitBackend,
+		"RATE_LIMITS":                    m.rateLimitsStr,
+		"IDEMPOTENCY_ENABLED":            m.idempotencyEnabled,
+		"IDEMPOTENCY_TTL":                m.idempotencyTTL.String(),
+		"EVENTS_BACKLOG_SIZE":            m.eventsBacklogSize,
+		"API_ROOT_DEPRECATED_AT":         deprecatedAt,
+		"API_ROOT_SUNSET":                sunset,
+		"CORS_ALLOWED_ORIGINS":           m.corsAllowedOrigins,
+		"CORS_ALLOWED_METHODS":           m.corsAllowedMethods,
+		"CORS_ALLOWED_HEADERS":           m.corsAllowedHeaders,
+		"CORS_ALLOW_CREDENTIALS":         m.corsAllowCredentials,
+		"CORS_MAX_AGE":                   m.corsMaxAge.String(),
+		"HTTP_READ_TIMEOUT":              m.httpReadTimeout.String(),
+		"HTTP_WRITE_TIMEOUT":             m.httpWriteTimeout.String(),
+		"HTTP_IDLE_TIMEOUT":              m.httpIdleTimeout.String(),
+		"HTTP_MAX_BODY_SIZE":             m.httpMaxBodySize,
+		"IMPORT_MAX_SIZE":                m.importMaxSize,
+		"SHUTDOWN_TIMEOUT":               m.shutdownTimeout.String(),
+		"SHUTDOWN_DELAY":                 m.shutdownDelay.String(),
+		"HEALTH_CHECK_INTERVAL":          m.healthCheckInterval.String(),
+		"HEALTH_CHECK_TIMEOUT":           m.healthCheckTimeout.String(),
+		"ADMIN_TOKEN":                    redactSecret(m.adminToken),
+		"REQUEST_TIMEOUTS":               m.requestTimeoutsStr,
+		"ACCESS_LOG_EXCLUDE_PATHS":       m.accessLogExcludePaths,
+		"ACCESS_LOG_SLOW_THRESHOLD":      m.accessLogSlowThreshold.String(),
+	}
+}
+
+func redactSecret(s string) string {
+	if s == "" {
+		return ""
+	}
+	return redacted
+}
+
+// redactParams replaces the values of params whose names look like secrets.
+func redactParams(params map[string]string) map[string]string {
+	if params == nil {
+		return nil
+	}
+	res := make(map[string]string, len(params))
+	for k, v := range params {
+		res[k] = v
+		for _, secret := range secretParamKeys {
+			if strings.Contains(strings.ToLower(k), secret) {
+				res[k] = redactSecret(v)
+				break
+			}
+		}
+	}
+	return res
+}
+
+// redactMySQLConn replaces the password of a mysql DSN, DSNs that can't be parsed are redacted entirely.
+func redactMySQLConn(dsn string) string {
+	if dsn == "" {
+		return ""
+	}
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return redacted
+	}
+	if cfg.Passwd != "" {
+		cfg.Passwd = redacted
+	}
+	return cfg.FormatDSN()
+}
+
+// redactURL replaces the password of a URL, URLs that can't be parsed are redacted entirely.
+func redactURL(s string) string {
+	if s == "" {
+		return ""
+	}
+	u, err := url.Parse(s)
+	if err != nil {
+		return redacted
+	}
+	if _, ok := u.User.Password(); ok {
+		u.User = url.UserPassword(u.User.Username(), redacted)
+	}
+	return strings.Replace(u.String(), url.QueryEscape(redacted), redacted, 1)
+}
@@ -0,0 +1,192 @@
+package events
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/types"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultBacklogSize = 1000
+	// subscriptionBuffer is the number of events a subscriber can fall behind before it is dropped.
+	subscriptionBuffer = 64
+)
+
+type Type string
+
+const (
+	TypeItemCreated Type = "item.created"
+	TypeItemUpdated Type = "item.updated"
+	TypeItemDeleted Type = "item.deleted"
+)
+
+// Event is a change of an item. Item is not set for deleted items, which only have ItemID.
+// IDs are <boot id>-<sequence>, the boot id is random for every broker, so IDs issued before a restart or by
+// another instance are not mistaken for IDs of this broker.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      Type        `json:"type"`
+	AccountID string      `json:"-"`
+	ItemID    string      `json:"item_id"`
+	Item      *types.Item `json:"item,omitempty"`
+	Time      time.Time   `json:"time"`
+
+	seq uint64
+}
+
+// Broker fans the events published in this process out to the subscribers of their account,
+// and keeps the latest events so subscribers can resume after reconnecting.
+type Broker struct {
+	mu      sync.Mutex
+	bootID  string
+	lastSeq uint64
+	// backlog is a ring buffer of the latest events, the oldest is at index first once it is full
+	backlog     []Event
+	first       int
+	backlogSize int
+	subs        map[*Subscription]struct{}
+	now         func() time.Time
+}
+
+type Option func(b *Broker)
+
+// WithBacklogSize sets the number of latest events kept for resuming subscribers.
+func WithBacklogSize(n int) Option {
+	return func(b *Broker) {
+		if n > 0 {
+			b.backlogSize = n
+		}
+	}
+}
+
+func NewBroker(opts ...Option) *Broker {
+	b := &Broker{
+		bootID:      newBootID(),
+		backlogSize: DefaultBacklogSize,
+		subs:        make(map[*Subscription]struct{}),
+		now:         time.Now,
+	}
+	for _, opt := range opts {
+		opt(b)
+	}
+	return b
+}
+
+// Publish assigns ev the next event ID and delivers it to the subscribers of its account. Subscribers that fell
+// too far behind are dropped instead of blocking the publisher.
+func (b *Broker) Publish(_ context.Context, ev Event) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastSeq++
+	ev.seq = b.lastSeq
+	ev.ID = fmt.Sprintf("%s-%d", b.bootID, ev.seq)
+	ev.Time = b.now()
+	if len(b.backlog) < b.backlogSize {
+		b.backlog = append(b.backlog, ev)
+	} else {
+		b.backlog[b.first] = ev
+		b.first = (b.first + 1) % len(b.backlog)
+	}
+
+	for sub := range b.subs {
+		if sub.accountID != ev.AccountID {
+			continue
+		}
+		select {
+		case sub.ch <- ev:
+		default:
+			sub.overflowed = true
+			b.remove(sub)
+		}
+	}
+}
+
+// Subscribe returns a subscription to the events of the account published from now on, with the events of the
+// account published after lastID that are still in the backlog, an empty lastID replays nothing. Resumed is false
+// when events after lastID were dropped from the backlog or lastID was not issued by this broker, so the subscriber
+// may have missed events.
+func (b *Broker) Subscribe(accountID string, lastID string) (sub *Subscription, missed []Event, resumed bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &Subscription{
+		accountID: accountID,
+		ch:        make(chan Event, subscriptionBuffer),
+		broker:    b,
+	}
+	b.subs[sub] = struct{}{}
+
+	if lastID == "" {
+		return sub, nil, true
+	}
+	lastSeq, ok := b.parseID(lastID)
+	if !ok || lastSeq > b.lastSeq {
+		return sub, nil, false
+	}
+	// the sequences in the backlog are consecutive, lastSeq is covered if the event after it is still there
+	resumed = len(b.backlog) == 0 || b.backlog[b.first].seq <= lastSeq+1
+	for i := range b.backlog {
+		ev := b.backlog[(b.first+i)%len(b.backlog)]
+		if ev.seq > lastSeq && ev.AccountID == accountID {
+			missed = append(missed, ev)
+		}
+	}
+	return sub, missed, resumed
+}
+
+// parseID returns the sequence of an event ID issued by this broker.
+func (b *Broker) parseID(id string) (uint64, bool) {
+	bootID, seq, ok := strings.Cut(id, "-")
+	if !ok || bootID != b.bootID {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	return n, err == nil
+}
+
+// remove stops delivering events to sub, b.mu must be held.
+func (b *Broker) remove(sub *Subscription) {
+	if _, ok := b.subs[sub]; !ok {
+		return
+	}
+	delete(b.subs, sub)
+	close(sub.ch)
+}
+
+type Subscription struct {
+	accountID  string
+	ch         chan Event
+	broker     *Broker
+	overflowed bool
+}
+
+// Events is closed when the subscription is closed, or when the subscriber fell too far behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.ch
+}
+
+// Overflowed reports whether the subscription was dropped for falling behind, it is set once Events is closed.
+func (s *Subscription) Overflowed() bool {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	return s.overflowed
+}
+
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+	s.broker.remove(s)
+}
+
+func newBootID() string {
+	b := make([]byte, 6)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,108 @@
+package events
+
+import (
+	"context"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/types"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+func TestBroker_Publish(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := NewBroker()
+
+	sub, missed, resumed := b.Subscribe("acc-1", "")
+	t.Cleanup(sub.Close)
+	require.Empty(t, missed)
+	require.True(t, resumed)
+	other, _, _ := b.Subscribe("acc-2", "")
+	t.Cleanup(other.Close)
+
+	item := types.Item{ID: "item-1", AccountID: "acc-1"}
+	b.Publish(ctx, Event{Type: TypeItemCreated, AccountID: "acc-1", ItemID: item.ID, Item: &item})
+	b.Publish(ctx, Event{Type: TypeItemDeleted, AccountID: "acc-1", ItemID: item.ID})
+
+	ev := <-sub.Events()
+	require.Equal(t, b.bootID+"-1", ev.ID)
+	require.Equal(t, TypeItemCreated, ev.Type)
+	require.Equal(t, &item, ev.Item)
+	require.False(t, ev.Time.IsZero())
+	ev = <-sub.Events()
+	require.Equal(t, b.bootID+"-2", ev.ID)
+	require.Equal(t, TypeItemDeleted, ev.Type)
+
+	// events of other accounts are not delivered
+	require.Empty(t, other.Events())
+
+	sub.Close()
+	_, ok := <-sub.Events()
+	require.False(t, ok)
+	require.False(t, sub.Overflowed())
+}
+
+func TestBroker_Resume(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := NewBroker(WithBacklogSize(3))
+	for i := range 5 {
+		accountID := "acc-1"
+		if i == 3 {
+			accountID = "acc-2"
+		}
+		b.Publish(ctx, Event{Type: TypeItemUpdated, AccountID: accountID})
+	}
+
+	id := func(seq int) string {
+		return fmt.Sprintf("%s-%d", b.bootID, seq)
+	}
+	tests := map[string]struct {
+		lastID      string
+		wantIDs     []string
+		wantResumed bool
+	}{
+		"covered":      {lastID: id(2), wantIDs: []string{id(3), id(5)}, wantResumed: true},
+		"up_to_date":   {lastID: id(5), wantResumed: true},
+		"dropped":      {lastID: id(1), wantIDs: []string{id(3), id(5)}, wantResumed: false},
+		"unknown":      {lastID: id(9), wantResumed: false},
+		"no_last_id":   {lastID: "", wantResumed: true},
+		"last_covered": {lastID: id(4), wantIDs: []string{id(5)}, wantResumed: true},
+		// ids issued before a restart or by another instance
+		"other_broker": {lastID: NewBroker().bootID + "-4", wantResumed: false},
+		"invalid":      {lastID: "4", wantResumed: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			sub, missed, resumed := b.Subscribe("acc-1", tc.lastID)
+			t.Cleanup(sub.Close)
+			var ids []string
+			for _, ev := range missed {
+				ids = append(ids, ev.ID)
+			}
+			require.Equal(t, tc.wantIDs, ids)
+			require.Equal(t, tc.wantResumed, resumed)
+		})
+	}
+}
+
+func TestBroker_Overflow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	b := NewBroker()
+	sub, _, _ := b.Subscribe("acc-1", "")
+	t.Cleanup(sub.Close)
+
+	for range subscriptionBuffer + 1 {
+		b.Publish(ctx, Event{Type: TypeItemUpdated, AccountID: "acc-1"})
+	}
+	n := 0
+	for range sub.Events() {
+		n++
+	}
+	require.Equal(t, subscriptionBuffer, n)
+	require.True(t, sub.Overflowed())
+}
@@ -3,9 +3,13 @@ package main
 import (
 	"context"
 	"github.com/Av1shay/di-demo/authentication"
-	"github.com/Av1shay/di-demo/cache/memory"
-	"github.com/Av1shay/di-demo/cache/redis"
+	cachepkg "github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/cache/invalidation"
+	"github.com/Av1shay/di-demo/cache/provider"
 	"github.com/Av1shay/di-demo/config"
+	"github.com/Av1shay/di-demo/events"
+	ratelimitmemory "github.com/Av1shay/di-demo/ratelimit/memory"
+	ratelimitredis "github.com/Av1shay/di-demo/ratelimit/redis"
 	"github.com/Av1shay/di-demo/repositories/mongo"
 	"github.com/Av1shay/di-demo/repositories/mysql"
 	"github.com/Av1shay/di-demo/server"
@@ -17,7 +21,10 @@ import (
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
 	"strconv"
+	"syscall"
+	"time"
 )
 
 const (
@@ -33,10 +40,19 @@ func init() {
 	slog.SetDefault(slog.New(h))
 }
 
+// closer releases a dependency on shutdown.
+type closer struct {
+	name  string
+	close func(ctx context.Context) error
+}
+
 func main() {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
+	sigCtx, stop := signal.NotifyContext(ctx, syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+
 	if err := godotenv.Load(); err != nil {
 		log.Fatal("Error loading .env file", err)
 	}
@@ -51,38 +67,99 @@ func main() {
 		log.Fatalf("Failed to init config: %v", err)
 	}
 
-	serv := resolveDependencies(ctx, confManager)
+	serv, closers := resolveDependencies(ctx, confManager)
 
 	serv.MountHandlers()
 
-	log.Println("Server listening on port " + port)
+	httpServer := &http.Server{
+		Addr:         ":" + port,
+		Handler:      serv.Router(),
+		ReadTimeout:  confManager.HTTPReadTimeout(),
+		WriteTimeout: confManager.HTTPWriteTimeout(),
+		IdleTimeout:  confManager.HTTPIdleTimeout(),
+	}
+
+	serveErr := make(chan error, 1)
+	go func() {
+		log.Println("Server listening on port " + port)
+		serveErr <- httpServer.ListenAndServe()
+	}()
 
-	if err := http.ListenAndServe(":"+port, serv.Router()); err != nil {
+	select {
+	case err := <-serveErr:
 		log.Fatal("Server failed to listen:", err)
+	case <-sigCtx.Done():
+	}
+	stop()
+
+	log.Println("Shutting down server")
+
+	// fail the readiness check first so load balancers stop sending new requests
+	serv.StartShutdown()
+	time.Sleep(confManager.ShutdownDelay())
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), confManager.ShutdownTimeout())
+	defer cancelShutdown()
+
+	if err := httpServer.Shutdown(shutdownCtx); err != nil {
+		log.Println("Failed to drain in-flight requests: ", err)
 	}
+
+	// stop background work (health checks, cache invalidations) before closing what it uses
+	cancel()
+
+	for _, c := range closers {
+		if err := c.close(shutdownCtx); err != nil {
+			log.Printf("Failed to close %s: %v", c.name, err)
+		}
+	}
+
+	log.Println("Server stopped")
 }
 
-func resolveDependencies(ctx context.Context, confManager *config.Manager) *server.Server {
+// resolveDependencies creates the server and returns it with the dependencies to close on shutdown, in closing order.
+func resolveDependencies(ctx context.Context, confManager *config.Manager) (*server.Server, []closer) {
 	var (
-		repo  uam.Repository
-		cache uam.Cache
-		err   error
+		repo    uam.Repository
+		cache   uam.Cache
+		closers []closer
+		err     error
 	)
 
 	switch confManager.DataSource() {
 	case config.DataSourceMySQL:
-		repo, err = mysql.NewRepository(confManager.MySQLConn())
+		mysqlRepo, err := mysql.NewRepository(confManager.MySQLConn())
 		if err != nil {
 			log.Fatal("Error creating mysql repository: ", err)
 		}
+		repo = mysqlRepo
+		closers = append(closers, closer{name: "mysql repository", close: func(_ context.Context) error {
+			return mysqlRepo.Close()
+		}})
 	case config.DataSourceMongo:
-		repo, err = mongo.NewRepository(confManager.MongoURI(), confManager.MongoDB())
+		mongoRepo, err := mongo.NewRepository(confManager.MongoURI(), confManager.MongoDB())
 		if err != nil {
 			log.Fatal("Error creating new mongo repository: ", err)
 		}
+		repo = mongoRepo
+		closers = append(closers, closer{name: "mongo repository", close: mongoRepo.Close})
+	}
+
+	cache, closeCache, err := provider.New(ctx, string(confManager.CacheProvider()), confManager.CacheProviderOptions())
+	if err != nil {
+		log.Fatal("Error creating cache: ", err)
+	}
+	closers = append(closers, closer{name: "cache", close: func(_ context.Context) error {
+		return closeCache()
+	}})
+	if confManager.CacheProvider() != config.CacheProviderNone {
+		cache = cachepkg.NewBreaker(cache, confManager.CacheBreakerConfig())
 	}
 
-	if confManager.CacheProvider() == config.CacheProviderRedis {
+	// item events are published by the uam.API and streamed by the server
+	broker := events.NewBroker(events.WithBacklogSize(confManager.EventsBacklogSize()))
+	uamOpts := []uam.Option{uam.WithEventPublisher(broker)}
+	if confManager.CacheInvalidationEnabled() {
 		rdb := redissdk.NewClient(&redissdk.Options{
 			Addr:     confManager.RedisAddr(),
 			Password: confManager.RedisPassword(),
@@ -90,25 +167,91 @@ func resolveDependencies(ctx context.Context, confManager *config.Manager) *serv
 		if err := rdb.Ping(ctx).Err(); err != nil {
 			log.Println("Failed to ping Redis: ", err)
 		}
-		cache = redis.NewCache(rdb)
-	} else {
-		// default in-memory cache
-		cache = memory.NewCache()
+		closers = append(closers, closer{name: "invalidation bus redis client", close: func(_ context.Context) error {
+			return rdb.Close()
+		}})
+		uamOpts = append(uamOpts, uam.WithInvalidationBus(invalidation.NewRedisBus(rdb, invalidation.DefaultChannel)))
 	}
 
-	uamAPI, err := uam.NewAPI(confManager.UAMAPIConfig(), repo, cache)
+	uamAPI, err := uam.NewAPI(confManager.UAMAPIConfig(), repo, cache, uamOpts...)
 	if err != nil {
 		log.Fatal("Error creating UAM API: ", err)
 	}
 
+	if confManager.CacheInvalidationEnabled() {
+		if err := uamAPI.SubscribeInvalidations(ctx); err != nil {
+			log.Fatal("Error subscribing to cache invalidations: ", err)
+		}
+	}
+
 	validate := validator.New(validator.WithRequiredStructEnabled())
 
 	auth := authentication.NewClient()
 
-	serv, err := server.New(ctx, validate, auth, uamAPI)
+	servOpts := []server.Option{
+		server.WithRequestValidation(confManager.OpenAPIValidationEnabled()),
+		server.WithMaxBodySize(confManager.HTTPMaxBodySize()),
+		server.WithMaxImportSize(confManager.ImportMaxSize()),
+		server.WithRootDeprecation(confManager.APIRootDeprecation()),
+		server.WithEventBroker(broker),
+		server.WithHealthCheckConfig(confManager.HealthCheckInterval(), confManager.HealthCheckTimeout()),
+		server.WithRouteTimeouts(confManager.RequestTimeouts()),
+		server.WithAccessLog(server.AccessLogOptions{
+			ExcludePaths:  confManager.AccessLogExcludePaths(),
+			SlowThreshold: confManager.AccessLogSlowThreshold(),
+		}),
+	}
+	if confManager.AdminToken() != "" {
+		servOpts = append(servOpts, server.WithAdmin(confManager.AdminToken(), confManager.RedactedConfig))
+	}
+	if confManager.CORSEnabled() {
+		servOpts = append(servOpts, server.WithCORS(server.CORSOptions{
+			AllowedOrigins:   confManager.CORSAllowedOrigins(),
+			AllowedMethods:   confManager.CORSAllowedMethods(),
+			AllowedHeaders:   confManager.CORSAllowedHeaders(),
+			AllowCredentials: confManager.CORSAllowCredentials(),
+			MaxAge:           confManager.CORSMaxAge(),
+		}))
+	}
+	if confManager.IdempotencyEnabled() {
+		servOpts = append(servOpts, server.WithIdempotency(cache, confManager.IdempotencyTTL()))
+	}
+	switch confManager.RateLimitBackend() {
+	case config.RateLimitBackendMemory:
+		servOpts = append(servOpts, server.WithRateLimiter(ratelimitmemory.NewLimiter(), confManager.RateLimits()))
+	case config.RateLimitBackendRedis:
+		rdb := redissdk.NewClient(&redissdk.Options{
+			Addr:     confManager.RedisAddr(),
+			Password: confManager.RedisPassword(),
+		})
+		if err := rdb.Ping(ctx).Err(); err != nil {
+			log.Println("Failed to ping Redis: ", err)
+		}
+		closers = append(closers, closer{name: "rate limiter redis client", close: func(_ context.Context) error {
+			return rdb.Close()
+		}})
+		limiter := ratelimitredis.NewLimiter(rdb, ratelimitredis.DefaultKeyPrefix)
+		servOpts = append(servOpts, server.WithRateLimiter(limiter, confManager.RateLimits()))
+	}
+
+	serv, err := server.New(ctx, validate, auth, uamAPI, servOpts...)
 	if err != nil {
 		log.Fatal("Error creating server: ", err)
 	}
 
-	return serv
+	if confManager.CacheWarmUpEnabled() {
+		// the server reports unhealthy until the cache is warm
+		serv.SetReady(false)
+		go func() {
+			defer serv.SetReady(true)
+			n, err := uamAPI.WarmUp(ctx, confManager.CacheWarmUpOptions())
+			if err != nil {
+				log.Println("Cache warm-up failed: ", err)
+				return
+			}
+			log.Printf("Cache warm-up loaded %d items", n)
+		}()
+	}
+
+	return serv, closers
 }
@@ -11,18 +11,36 @@ const (
 	ErrorCodeValidation   ErrorCode = "VALIDATION_ERROR"
 	ErrorCodeUnauthorized ErrorCode = "UNAUTHORIZED_ERROR"
 	ErrorCodeBadRequest   ErrorCode = "BAD_REQUEST"
+	ErrorCodeRateLimited  ErrorCode = "RATE_LIMITED"
+	ErrorCodePrecondition ErrorCode = "PRECONDITION_FAILED"
+	ErrorCodeIdempotency  ErrorCode = "IDEMPOTENCY_KEY_REUSED"
+	ErrorCodeTooLarge     ErrorCode = "PAYLOAD_TOO_LARGE"
+	ErrorCodeMediaType    ErrorCode = "UNSUPPORTED_MEDIA_TYPE"
+	ErrorCodeNotAccepted  ErrorCode = "NOT_ACCEPTABLE"
+	ErrorCodeTimeout      ErrorCode = "TIMEOUT"
 )
 
+// FieldError describes a single invalid field of a request and the rule it failed.
+type FieldError struct {
+	Field string `json:"field"`
+	Rule  string `json:"rule"`
+}
+
 type AppError struct {
-	Code ErrorCode `json:"code"`
-	Msg  string    `json:"message"`
-	Err  error     `json:"-"`
+	Code    ErrorCode    `json:"code"`
+	Msg     string       `json:"message"`
+	Details []FieldError `json:"details,omitempty"`
+	Err     error        `json:"-"`
 }
 
 func (e *AppError) Error() string {
 	return fmt.Sprintf("[%s]: %s", e.Code, e.Msg)
 }
 
+func (e *AppError) Unwrap() error {
+	return e.Err
+}
+
 func NewAppErr(err error, msg string, code ErrorCode) *AppError {
 	return &AppError{
 		Code: code,
@@ -46,3 +64,21 @@ func NewNotFoundErr(err error, msg string) *AppError {
 func NewBadRequestErr(err error, msg string) *AppError {
 	return NewAppErr(err, msg, ErrorCodeBadRequest)
 }
+
+func NewRateLimitedErr(err error, msg string) *AppError {
+	return NewAppErr(err, msg, ErrorCodeRateLimited)
+}
+
+func NewPreconditionFailedErr(err error, msg string) *AppError {
+	return NewAppErr(err, msg, ErrorCodePrecondition)
+}
+
+func NewTimeoutErr(err error, msg string) *AppError {
+	return NewAppErr(err, msg, ErrorCodeTimeout)
+}
+
+func NewValidationErr(err error, msg string, details []FieldError) *AppError {
+	appErr := NewAppErr(err, msg, ErrorCodeValidation)
+	appErr.Details = details
+	return appErr
+}
@@ -8,7 +8,10 @@ import (
 
 type ctxKey string
 
-var traceIDCtxKey = ctxKey("trace_id")
+var (
+	traceIDCtxKey   = ctxKey("trace_id")
+	requestIDCtxKey = ctxKey("request_id")
+)
 
 func Logf(ctx context.Context, lvl slog.Level, format string, args ...any) {
 	msg := fmt.Sprintf(format, args...)
@@ -17,6 +20,9 @@ func Logf(ctx context.Context, lvl slog.Level, format string, args ...any) {
 	if traceID != "" {
 		logArgs = append(logArgs, slog.String("trace_id", traceID))
 	}
+	if requestID := RequestIDFromContext(ctx); requestID != "" {
+		logArgs = append(logArgs, slog.String("request_id", requestID))
+	}
 	slog.Log(ctx, lvl, msg, logArgs...)
 }
 
@@ -24,6 +30,10 @@ func Infof(ctx context.Context, format string, args ...any) {
 	Logf(ctx, slog.LevelInfo, format, args...)
 }
 
+func Warnf(ctx context.Context, format string, args ...any) {
+	Logf(ctx, slog.LevelWarn, format, args...)
+}
+
 func Errorf(ctx context.Context, format string, args ...any) {
 	Logf(ctx, slog.LevelError, format, args...)
 }
@@ -42,3 +52,15 @@ func TraceIDFromContext(ctx context.Context) string {
 	}
 	return ""
 }
+
+// ContextWithRequestID sets the request ID of the caller, logged next to the trace ID.
+func ContextWithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDCtxKey, requestID)
+}
+
+func RequestIDFromContext(ctx context.Context) string {
+	if requestID, ok := ctx.Value(requestIDCtxKey).(string); ok {
+		return requestID
+	}
+	return ""
+}
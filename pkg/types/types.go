@@ -24,6 +24,97 @@ type UpdateItemInput struct {
 	ID    string `json:"-"`
 	Name  string `json:"name" validate:"required"`
 	Value string `json:"value"`
+	// ExpectedVersion makes the update fail unless the item is at this version, zero updates any version.
+	ExpectedVersion int `json:"-"`
+}
+
+// PatchItemInput changes only the fields that are set.
+type PatchItemInput struct {
+	ID    string  `json:"-"`
+	Name  *string `json:"name" validate:"omitnil,min=1"`
+	Value *string `json:"value"`
+	// ExpectedVersion makes the patch fail unless the item is at this version, zero patches any version.
+	ExpectedVersion int `json:"-"`
+}
+
+type DeleteItemInput struct {
+	ID string
+	// ExpectedVersion makes the delete fail unless the item is at this version, zero deletes any version.
+	ExpectedVersion int
+}
+
+type ImportPolicy string
+
+const (
+	// ImportPolicySkip keeps existing items and skips the rows with their names.
+	ImportPolicySkip ImportPolicy = "skip"
+	// ImportPolicyOverwrite updates the value of existing items from the rows with their names.
+	ImportPolicyOverwrite ImportPolicy = "overwrite"
+	// ImportPolicyFail aborts the import at the first row with the name of an existing item.
+	ImportPolicyFail ImportPolicy = "fail"
+)
+
+// ImportRow is an item to create from an uploaded file.
+type ImportRow struct {
+	// Line is the line of the row in the file, reported back in the import summary.
+	Line int
+	ItemCreateInput
+}
+
+type ImportItemsInput struct {
+	Rows []ImportRow `json:"-"`
+	// Policy handles the rows with the name of an existing item, defaults to ImportPolicyFail.
+	Policy ImportPolicy `json:"on_conflict" validate:"omitempty,oneof=skip overwrite fail"`
+}
+
+type ImportRowStatus string
+
+const (
+	ImportRowUpdated ImportRowStatus = "updated"
+	ImportRowSkipped ImportRowStatus = "skipped"
+	ImportRowFailed  ImportRowStatus = "failed"
+)
+
+// ImportRowResult is the outcome of a row that was not created.
+type ImportRowResult struct {
+	Line   int             `json:"line"`
+	Name   string          `json:"name,omitempty"`
+	Status ImportRowStatus `json:"status"`
+	Error  string          `json:"error,omitempty"`
+}
+
+type ImportSummary struct {
+	Created int `json:"created"`
+	Updated int `json:"updated"`
+	Skipped int `json:"skipped"`
+	Failed  int `json:"failed"`
+	// Aborted is set when the import stopped at its last row, the rows after it were not imported.
+	Aborted bool `json:"aborted"`
+	// Rows are the rows that were not created, in file order.
+	Rows []ImportRowResult `json:"rows,omitempty"`
+}
+
+// AddRow counts a row that was not created.
+func (s *ImportSummary) AddRow(row ImportRowResult) {
+	switch row.Status {
+	case ImportRowUpdated:
+		s.Updated++
+	case ImportRowSkipped:
+		s.Skipped++
+	case ImportRowFailed:
+		s.Failed++
+	}
+	s.Rows = append(s.Rows, row)
+}
+
+// Merge adds the counts and rows of o, the summary of the rows after the rows of s.
+func (s *ImportSummary) Merge(o ImportSummary) {
+	s.Created += o.Created
+	s.Updated += o.Updated
+	s.Skipped += o.Skipped
+	s.Failed += o.Failed
+	s.Aborted = s.Aborted || o.Aborted
+	s.Rows = append(s.Rows, o.Rows...)
 }
 
 type Sort string
@@ -65,6 +156,11 @@ type ListItemsInput struct {
 	Limit   int     `json:"limit"`
 }
 
+type RecentItemsInput struct {
+	PerAccount int
+	Limit      int
+}
+
 type User struct {
 	ID        string
 	Name      string
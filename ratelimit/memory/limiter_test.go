@@ -0,0 +1,50 @@
+package memory
+
+import (
+	"context"
+	"github.com/Av1shay/di-demo/ratelimit"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	now := time.Now()
+	l := NewLimiter()
+	l.now = func() time.Time { return now }
+	limit := ratelimit.Limit{Requests: 1, Per: time.Second, Burst: 2}
+
+	for i := range 2 {
+		res, err := l.Allow(ctx, "key", limit)
+		require.NoError(t, err)
+		require.True(t, res.Allowed)
+		require.Equal(t, 2, res.Limit)
+		require.Equal(t, 1-i, res.Remaining)
+	}
+
+	res, err := l.Allow(ctx, "key", limit)
+	require.NoError(t, err)
+	require.False(t, res.Allowed)
+	require.Equal(t, 0, res.Remaining)
+	require.Equal(t, time.Second, res.RetryAfter)
+	require.Equal(t, 2*time.Second, res.ResetAfter)
+
+	// other keys have their own bucket
+	res, err = l.Allow(ctx, "other", limit)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+
+	now = now.Add(time.Second)
+	res, err = l.Allow(ctx, "key", limit)
+	require.NoError(t, err)
+	require.True(t, res.Allowed)
+
+	// full buckets are dropped
+	now = now.Add(sweepInterval)
+	_, err = l.Allow(ctx, "key", limit)
+	require.NoError(t, err)
+	require.Len(t, l.buckets, 1)
+}
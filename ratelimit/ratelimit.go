@@ -0,0 +1,94 @@
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Limit is a token bucket refilled with Requests tokens every Per, holding up to Burst tokens.
+type Limit struct {
+	Requests int
+	Per      time.Duration
+	Burst    int
+}
+
+// Rate returns the number of tokens added to the bucket per second.
+func (l Limit) Rate() float64 {
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+// Capacity returns the bucket size, Requests when no Burst is set.
+func (l Limit) Capacity() int {
+	if l.Burst > 0 {
+		return l.Burst
+	}
+	return l.Requests
+}
+
+func (l Limit) Valid() bool {
+	return l.Requests > 0 && l.Per > 0 && l.Burst >= 0
+}
+
+// ParseLimit parses a limit in the format <requests>/<period>[:<burst>], e.g. "100/1m" or "10/s:20".
+func ParseLimit(s string) (Limit, error) {
+	rate, burst, hasBurst := strings.Cut(strings.TrimSpace(s), ":")
+	requests, period, ok := strings.Cut(rate, "/")
+	if !ok {
+		return Limit{}, fmt.Errorf("invalid limit %q, expected <requests>/<period>[:<burst>]", s)
+	}
+	var (
+		l   Limit
+		err error
+	)
+	if l.Requests, err = strconv.Atoi(requests); err != nil {
+		return Limit{}, fmt.Errorf("invalid requests in limit %q: %w", s, err)
+	}
+	if period != "" && (period[0] < '0' || period[0] > '9') {
+		period = "1" + period
+	}
+	if l.Per, err = time.ParseDuration(period); err != nil {
+		return Limit{}, fmt.Errorf("invalid period in limit %q: %w", s, err)
+	}
+	if hasBurst {
+		if l.Burst, err = strconv.Atoi(burst); err != nil {
+			return Limit{}, fmt.Errorf("invalid burst in limit %q: %w", s, err)
+		}
+	}
+	if !l.Valid() {
+		return Limit{}, fmt.Errorf("invalid limit %q, requests and period must be positive", s)
+	}
+	return l, nil
+}
+
+type Result struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// ResetAfter is the time until the bucket is full again.
+	ResetAfter time.Duration
+	// RetryAfter is the time until the next request is allowed, zero when allowed.
+	RetryAfter time.Duration
+}
+
+// NewResult builds the result of a request given the tokens left in the bucket after it.
+func NewResult(l Limit, tokens float64, allowed bool) Result {
+	rate := l.Rate()
+	res := Result{
+		Allowed:    allowed,
+		Limit:      l.Capacity(),
+		Remaining:  int(math.Floor(tokens)),
+		ResetAfter: time.Duration((float64(l.Capacity()) - tokens) / rate * float64(time.Second)),
+	}
+	if !allowed {
+		res.RetryAfter = time.Duration((1 - tokens) / rate * float64(time.Second))
+	}
+	return res
+}
+
+type Limiter interface {
+	Allow(ctx context.Context, key string, l Limit) (Result, error)
+}
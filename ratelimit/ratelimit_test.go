@@ -0,0 +1,37 @@
+package ratelimit
+
+import (
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestParseLimit(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		in      string
+		want    Limit
+		wantErr bool
+	}{
+		{in: "100/1m", want: Limit{Requests: 100, Per: time.Minute}},
+		{in: "10/s:20", want: Limit{Requests: 10, Per: time.Second, Burst: 20}},
+		{in: " 5/500ms ", want: Limit{Requests: 5, Per: 500 * time.Millisecond}},
+		{in: "100", wantErr: true},
+		{in: "x/1m", wantErr: true},
+		{in: "10/forever", wantErr: true},
+		{in: "10/1m:x", wantErr: true},
+		{in: "0/1m", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseLimit(tt.in)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
@@ -0,0 +1,72 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"github.com/Av1shay/di-demo/ratelimit"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+)
+
+const DefaultKeyPrefix = "di-demo:ratelimit:"
+
+// tokenBucketScript refills the bucket by the time elapsed since its last update, according to the redis
+// server clock so all instances agree, and takes a token when one is available.
+// It returns whether the request is allowed and the tokens left.
+var tokenBucketScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+
+local t = redis.call('TIME')
+local now = tonumber(t[1]) + tonumber(t[2]) / 1000000
+
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'updated')
+local tokens = tonumber(bucket[1])
+local updated = tonumber(bucket[2])
+if tokens == nil then
+	tokens = capacity
+	updated = now
+end
+
+tokens = math.min(capacity, tokens + math.max(0, now - updated) * rate)
+local allowed = 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'updated', tostring(now))
+redis.call('PEXPIRE', KEYS[1], math.ceil((capacity - tokens) / rate * 1000) + 1000)
+
+return {allowed, tostring(tokens)}
+`)
+
+// Limiter is a token bucket rate limiter keeping its buckets in redis, limits are shared by all instances.
+type Limiter struct {
+	rdb       *redis.Client
+	keyPrefix string
+}
+
+func NewLimiter(rdb *redis.Client, keyPrefix string) *Limiter {
+	if keyPrefix == "" {
+		keyPrefix = DefaultKeyPrefix
+	}
+	return &Limiter{rdb: rdb, keyPrefix: keyPrefix}
+}
+
+func (l *Limiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	res, err := tokenBucketScript.Run(ctx, l.rdb, []string{l.keyPrefix + key}, limit.Capacity(), limit.Rate()).Slice()
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("failed to run rate limit script: %w", err)
+	}
+	if len(res) != 2 {
+		return ratelimit.Result{}, fmt.Errorf("unexpected rate limit script result: %v", res)
+	}
+	allowed, _ := res[0].(int64)
+	tokensStr, _ := res[1].(string)
+	tokens, err := strconv.ParseFloat(tokensStr, 64)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("invalid tokens in rate limit script result: %w", err)
+	}
+	return ratelimit.NewResult(limit, tokens, allowed == 1), nil
+}
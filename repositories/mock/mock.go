@@ -7,19 +7,34 @@ import (
 
 type Repository struct {
 	ReturnErr        error
+	GetItemIn        string
+	GetItemRes       types.Item
 	GetItemByNameIn  string
 	GetItemByNameRes types.Item
 	SaveItemIn       types.ItemCreateInput
+	SaveItemErrs     map[string]error
 	UpdateItemIn     types.UpdateItemInput
 	SaveItemRes      types.Item
 	UpdateItemRes    types.Item
+	PatchItemIn      types.PatchItemInput
+	PatchItemRes     types.Item
 	ListItemsIn      types.ListItemsInput
 	ListItemsRes     []types.Item
+	ListRecentIn     types.RecentItemsInput
+	ListRecentRes    []types.Item
 	DeleteItemRes    error
-	DeleteItemIn     string
+	DeleteItemIn     types.DeleteItemInput
 	HcRes            error
 }
 
+func (m *Repository) GetItem(ctx context.Context, id, accountID string) (types.Item, error) {
+	if m.ReturnErr != nil {
+		return types.Item{}, m.ReturnErr
+	}
+	m.GetItemIn = id
+	return m.GetItemRes, nil
+}
+
 func (m *Repository) GetItemByName(ctx context.Context, name, accountID string) (types.Item, error) {
 	if m.ReturnErr != nil {
 		return types.Item{}, m.ReturnErr
@@ -33,6 +48,9 @@ func (m *Repository) SaveItem(ctx context.Context, input types.ItemCreateInput,
 		return types.Item{}, m.ReturnErr
 	}
 	m.SaveItemIn = input
+	if err := m.SaveItemErrs[input.Name]; err != nil {
+		return types.Item{}, err
+	}
 	return m.SaveItemRes, nil
 }
 
@@ -44,6 +62,14 @@ func (m *Repository) ListItems(ctx context.Context, input types.ListItemsInput,
 	return m.ListItemsRes, nil
 }
 
+func (m *Repository) ListRecentItems(ctx context.Context, input types.RecentItemsInput) ([]types.Item, error) {
+	if m.ReturnErr != nil {
+		return nil, m.ReturnErr
+	}
+	m.ListRecentIn = input
+	return m.ListRecentRes, nil
+}
+
 func (m *Repository) UpdateItem(ctx context.Context, input types.UpdateItemInput, accountID string) (types.Item, error) {
 	if m.ReturnErr != nil {
 		return types.Item{}, m.ReturnErr
@@ -52,14 +78,34 @@ func (m *Repository) UpdateItem(ctx context.Context, input types.UpdateItemInput
 	return m.UpdateItemRes, nil
 }
 
-func (m *Repository) DeleteItem(ctx context.Context, id, accountID string) error {
+func (m *Repository) PatchItem(ctx context.Context, input types.PatchItemInput, accountID string) (types.Item, error) {
+	if m.ReturnErr != nil {
+		return types.Item{}, m.ReturnErr
+	}
+	m.PatchItemIn = input
+	return m.PatchItemRes, nil
+}
+
+func (m *Repository) DeleteItem(ctx context.Context, input types.DeleteItemInput, accountID string) error {
 	if m.ReturnErr != nil {
 		return m.ReturnErr
 	}
-	m.DeleteItemIn = id
+	m.DeleteItemIn = input
 	return m.DeleteItemRes
 }
 
+func (m *Repository) StreamItems(ctx context.Context, accountID string, fn func(types.Item) error) error {
+	if m.ReturnErr != nil {
+		return m.ReturnErr
+	}
+	for _, item := range m.ListItemsRes {
+		if err := fn(item); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (m *Repository) Ping(ctx context.Context) error {
 	return m.HcRes
 }
@@ -31,6 +31,27 @@ type Item struct {
 	UpdatedAt time.Time          `bson:"updated_at"`
 }
 
+func (r *Repository) GetItem(ctx context.Context, id string, accountID string) (types.Item, error) {
+	objID, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return types.Item{}, fmt.Errorf("failed to convert item id to ObjectID: %w", err)
+	}
+	var item Item
+	err = r.itemsColl.FindOne(ctx, bson.D{{Key: "_id", Value: objID}, {Key: "account_id", Value: accountID}}).Decode(&item)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return types.Item{}, &errs.AppError{
+				Code: errs.ErrorCodeNotFound,
+				Msg:  fmt.Sprintf("item with id %s not found", id),
+				Err:  err,
+			}
+		}
+		return types.Item{}, err
+	}
+
+	return parseItem(item), nil
+}
+
 func (r *Repository) GetItemByName(ctx context.Context, name string, accountID string) (types.Item, error) {
 	var item Item
 	err := r.itemsColl.FindOne(ctx, bson.M{"name": name, "account_id": accountID}).Decode(&item)
@@ -79,7 +100,10 @@ func (r *Repository) UpdateItem(ctx context.Context, input types.UpdateItemInput
 	if err != nil {
 		return types.Item{}, fmt.Errorf("failed to convert item id to ObjectID: %w", err)
 	}
-	filter := bson.D{{"_id", objID}, {"account_id", accountID}}
+	filter := bson.D{{Key: "_id", Value: objID}, {Key: "account_id", Value: accountID}}
+	if input.ExpectedVersion > 0 {
+		filter = append(filter, bson.E{Key: "version", Value: input.ExpectedVersion})
+	}
 	update := bson.M{
 		"$set": bson.M{
 			"name":       input.Name,
@@ -90,13 +114,63 @@ func (r *Repository) UpdateItem(ctx context.Context, input types.UpdateItemInput
 			"version": 1,
 		},
 	}
-	_, err = r.itemsColl.UpdateOne(ctx, filter, update)
+	res, err := r.itemsColl.UpdateOne(ctx, filter, update)
 	if err != nil {
 		return types.Item{}, err
 	}
+	if input.ExpectedVersion > 0 && res.MatchedCount == 0 {
+		// either the item does not exist or it is at another version
+		if _, err := r.GetItem(ctx, input.ID, accountID); err != nil {
+			return types.Item{}, err
+		}
+		return types.Item{}, versionMismatchErr(input.ID, input.ExpectedVersion)
+	}
 	return r.GetItemByName(ctx, input.Name, accountID)
 }
 
+func (r *Repository) PatchItem(ctx context.Context, input types.PatchItemInput, accountID string) (types.Item, error) {
+	objID, err := primitive.ObjectIDFromHex(input.ID)
+	if err != nil {
+		return types.Item{}, fmt.Errorf("failed to convert item id to ObjectID: %w", err)
+	}
+	filter := bson.D{{Key: "_id", Value: objID}, {Key: "account_id", Value: accountID}}
+	if input.ExpectedVersion > 0 {
+		filter = append(filter, bson.E{Key: "version", Value: input.ExpectedVersion})
+	}
+	set := bson.M{"updated_at": time.Now()}
+	if input.Name != nil {
+		set["name"] = *input.Name
+	}
+	if input.Value != nil {
+		set["value"] = *input.Value
+	}
+	update := bson.M{
+		"$set": set,
+		"$inc": bson.M{
+			"version": 1,
+		},
+	}
+	res, err := r.itemsColl.UpdateOne(ctx, filter, update)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return types.Item{}, &errs.AppError{
+				Code: errs.ErrorCodeDuplicate,
+				Msg:  fmt.Sprintf("item '%s' already exist", *input.Name),
+				Err:  err,
+			}
+		}
+		return types.Item{}, err
+	}
+	if res.MatchedCount == 0 {
+		// either the item does not exist or it is at another version
+		if _, err := r.GetItem(ctx, input.ID, accountID); err != nil {
+			return types.Item{}, err
+		}
+		return types.Item{}, versionMismatchErr(input.ID, input.ExpectedVersion)
+	}
+	return r.GetItem(ctx, input.ID, accountID)
+}
+
 func (r *Repository) ListItems(ctx context.Context, input types.ListItemsInput, accountID string) ([]types.Item, error) {
 	opts := options.Find()
 
@@ -109,13 +183,13 @@ func (r *Repository) ListItems(ctx context.Context, input types.ListItemsInput,
 		orderBy = ob
 	}
 
-	opts.SetSort(bson.D{{orderBy, sortOrder}})
+	opts.SetSort(bson.D{{Key: orderBy, Value: sortOrder}})
 
 	if input.Limit > 0 {
 		opts.SetLimit(int64(input.Limit))
 	}
 
-	cur, err := r.itemsColl.Find(ctx, bson.D{{"account_id", accountID}}, opts)
+	cur, err := r.itemsColl.Find(ctx, bson.D{{Key: "account_id", Value: accountID}}, opts)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
 			return nil, nil
@@ -140,16 +214,89 @@ func (r *Repository) ListItems(ctx context.Context, input types.ListItemsInput,
 	return res, nil
 }
 
-func (r *Repository) DeleteItem(ctx context.Context, id string, accountID string) error {
-	objID, err := primitive.ObjectIDFromHex(id)
+// ListRecentItems numbers the items of every account by their last update with $setWindowFields, which reads them in
+// the order of the account-updated index and spills to disk, instead of grouping whole accounts in one document.
+func (r *Repository) ListRecentItems(ctx context.Context, input types.RecentItemsInput) ([]types.Item, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$setWindowFields", Value: bson.D{
+			{Key: "partitionBy", Value: "$account_id"},
+			{Key: "sortBy", Value: bson.D{{Key: "updated_at", Value: -1}}},
+			{Key: "output", Value: bson.D{{Key: "rank", Value: bson.D{{Key: "$documentNumber", Value: bson.D{}}}}}},
+		}}},
+		{{Key: "$match", Value: bson.D{{Key: "rank", Value: bson.D{{Key: "$lte", Value: input.PerAccount}}}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "updated_at", Value: -1}}}},
+		{{Key: "$limit", Value: input.Limit}},
+	}
+
+	cur, err := r.itemsColl.Aggregate(ctx, pipeline, options.Aggregate().SetAllowDiskUse(true))
+	if err != nil {
+		return nil, err
+	}
+	defer cur.Close(ctx)
+
+	var res []types.Item
+	for cur.Next(ctx) {
+		var item Item
+		if err := cur.Decode(&item); err != nil {
+			return nil, err
+		}
+		res = append(res, parseItem(item))
+	}
+	if err := cur.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+func (r *Repository) DeleteItem(ctx context.Context, input types.DeleteItemInput, accountID string) error {
+	objID, err := primitive.ObjectIDFromHex(input.ID)
 	if err != nil {
 		return fmt.Errorf("failed to convert item id to ObjectID: %w", err)
 	}
-	_, err = r.itemsColl.DeleteOne(ctx, bson.D{
-		{"_id", objID},
-		{"account_id", accountID},
-	})
-	return err
+	filter := bson.D{
+		{Key: "_id", Value: objID},
+		{Key: "account_id", Value: accountID},
+	}
+	if input.ExpectedVersion > 0 {
+		filter = append(filter, bson.E{Key: "version", Value: input.ExpectedVersion})
+	}
+	res, err := r.itemsColl.DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if input.ExpectedVersion > 0 && res.DeletedCount == 0 {
+		// either the item does not exist or it is at another version
+		if _, err := r.GetItem(ctx, input.ID, accountID); err != nil {
+			return err
+		}
+		return versionMismatchErr(input.ID, input.ExpectedVersion)
+	}
+	return nil
+}
+
+func (r *Repository) StreamItems(ctx context.Context, accountID string, fn func(types.Item) error) error {
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	cur, err := r.itemsColl.Find(ctx, bson.D{{Key: "account_id", Value: accountID}}, opts)
+	if err != nil {
+		return err
+	}
+	defer cur.Close(ctx)
+
+	for cur.Next(ctx) {
+		var item Item
+		if err := cur.Decode(&item); err != nil {
+			return err
+		}
+		if err := fn(parseItem(item)); err != nil {
+			return err
+		}
+	}
+	return cur.Err()
+}
+
+func versionMismatchErr(id string, version int) error {
+	return errs.NewPreconditionFailedErr(nil, fmt.Sprintf("item with id %s is not at version %d", id, version))
 }
 
 func parseItem(item Item) types.Item {
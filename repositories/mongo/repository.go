@@ -36,6 +36,16 @@ func NewRepository(uri, dbName string) (*Repository, error) {
 	if _, err := itemsColl.Indexes().CreateOne(ctx, indexModel); err != nil {
 		return nil, fmt.Errorf("failed to create item name-account index: %w", err)
 	}
+	// ranks the items of every account by their last update when the cache is warmed up
+	recentIndexModel := mongo.IndexModel{
+		Keys: bson.D{
+			{Key: "account_id", Value: 1},
+			{Key: "updated_at", Value: -1},
+		},
+	}
+	if _, err := itemsColl.Indexes().CreateOne(ctx, recentIndexModel); err != nil {
+		return nil, fmt.Errorf("failed to create item account-updated index: %w", err)
+	}
 
 	return &Repository{
 		client:    client,
@@ -24,7 +24,8 @@ const (
 			version INT NOT NULL DEFAULT 1,
 			created_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP, 
 			updated_at DATETIME NOT NULL DEFAULT CURRENT_TIMESTAMP ON UPDATE CURRENT_TIMESTAMP,
-		    UNIQUE (name, account_id)
+		    UNIQUE (name, account_id),
+		    INDEX account_updated (account_id, updated_at)
 		)`
 )
 
@@ -150,19 +151,151 @@ func (r *Repository) ListItems(ctx context.Context, input types.ListItemsInput,
 	return res, nil
 }
 
+// ListRecentItems numbers the items of every account by their last update with ROW_NUMBER(). The window covers
+// the whole table, so it reads every row; the account_updated index lets it read them in partition order instead
+// of sorting the table, existing tables need it added with
+// ALTER TABLE items ADD INDEX account_updated (account_id, updated_at).
+func (r *Repository) ListRecentItems(ctx context.Context, input types.RecentItemsInput) ([]types.Item, error) {
+	query := fmt.Sprintf(`SELECT id, name, account_id, value, version, created_at, updated_at FROM (
+			SELECT id, name, account_id, value, version, created_at, updated_at,
+				ROW_NUMBER() OVER (PARTITION BY account_id ORDER BY updated_at DESC) AS rn
+			FROM %s
+		) ranked WHERE rn <= ? ORDER BY updated_at DESC LIMIT ?`, itemsTbName)
+
+	rows, err := r.db.QueryContext(ctx, query, input.PerAccount, input.Limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	res := make([]types.Item, 0, input.Limit)
+	for rows.Next() {
+		var item Item
+		err := rows.Scan(&item.ID, &item.Name, &item.AccountID, &item.Value, &item.Version, &item.CreatedAt, &item.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, parseItem(item))
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
 func (r *Repository) UpdateItem(ctx context.Context, input types.UpdateItemInput, accountID string) (types.Item, error) {
 	query := fmt.Sprintf("UPDATE %s SET name=?,value=?,version=version+1 WHERE id=? AND account_id=?", itemsTbName)
-	_, err := r.db.ExecContext(ctx, query, input.Name, input.Value, input.ID, accountID)
+	args := []any{input.Name, input.Value, input.ID, accountID}
+	if input.ExpectedVersion > 0 {
+		query += " AND version=?"
+		args = append(args, input.ExpectedVersion)
+	}
+	res, err := r.db.ExecContext(ctx, query, args...)
 	if err != nil {
 		return types.Item{}, err
 	}
+	if input.ExpectedVersion > 0 {
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			// either the item does not exist or it is at another version
+			if _, err := r.GetItem(ctx, input.ID, accountID); err != nil {
+				return types.Item{}, err
+			}
+			return types.Item{}, versionMismatchErr(input.ID, input.ExpectedVersion)
+		}
+	}
 	return r.GetItem(ctx, input.ID, accountID)
 }
 
-func (r *Repository) DeleteItem(ctx context.Context, id, accountID string) error {
+func (r *Repository) PatchItem(ctx context.Context, input types.PatchItemInput, accountID string) (types.Item, error) {
+	var (
+		sets []string
+		args []any
+	)
+	if input.Name != nil {
+		sets = append(sets, "name=?")
+		args = append(args, *input.Name)
+	}
+	if input.Value != nil {
+		sets = append(sets, "value=?")
+		args = append(args, *input.Value)
+	}
+	sets = append(sets, "version=version+1")
+	query := fmt.Sprintf("UPDATE %s SET %s WHERE id=? AND account_id=?", itemsTbName, strings.Join(sets, ","))
+	args = append(args, input.ID, accountID)
+	if input.ExpectedVersion > 0 {
+		query += " AND version=?"
+		args = append(args, input.ExpectedVersion)
+	}
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		var msqlErr *mysql.MySQLError
+		if errors.As(err, &msqlErr) && msqlErr.Number == 1062 {
+			return types.Item{}, &errs.AppError{
+				Code: errs.ErrorCodeDuplicate,
+				Msg:  fmt.Sprintf("item '%s' already exist", *input.Name),
+				Err:  err,
+			}
+		}
+		return types.Item{}, err
+	}
+	if n, err := res.RowsAffected(); err == nil && n == 0 {
+		// either the item does not exist or it is at another version
+		if _, err := r.GetItem(ctx, input.ID, accountID); err != nil {
+			return types.Item{}, err
+		}
+		return types.Item{}, versionMismatchErr(input.ID, input.ExpectedVersion)
+	}
+	return r.GetItem(ctx, input.ID, accountID)
+}
+
+func (r *Repository) DeleteItem(ctx context.Context, input types.DeleteItemInput, accountID string) error {
 	query := fmt.Sprintf("DELETE FROM %s WHERE id=? AND account_id=?", itemsTbName)
-	_, err := r.db.ExecContext(ctx, query, id, accountID)
-	return err
+	args := []any{input.ID, accountID}
+	if input.ExpectedVersion > 0 {
+		query += " AND version=?"
+		args = append(args, input.ExpectedVersion)
+	}
+	res, err := r.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	if input.ExpectedVersion > 0 {
+		if n, err := res.RowsAffected(); err == nil && n == 0 {
+			// either the item does not exist or it is at another version
+			if _, err := r.GetItem(ctx, input.ID, accountID); err != nil {
+				return err
+			}
+			return versionMismatchErr(input.ID, input.ExpectedVersion)
+		}
+	}
+	return nil
+}
+
+func (r *Repository) StreamItems(ctx context.Context, accountID string, fn func(types.Item) error) error {
+	query := fmt.Sprintf("SELECT id, name, account_id, value, version, created_at, updated_at FROM %s WHERE account_id=? ORDER BY created_at, id",
+		itemsTbName)
+	rows, err := r.db.QueryContext(ctx, query, accountID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var item Item
+		err := rows.Scan(&item.ID, &item.Name, &item.AccountID, &item.Value, &item.Version, &item.CreatedAt, &item.UpdatedAt)
+		if err != nil {
+			return err
+		}
+		if err := fn(parseItem(item)); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+func versionMismatchErr(id string, version int) error {
+	return errs.NewPreconditionFailedErr(nil, fmt.Sprintf("item with id %s is not at version %d", id, version))
 }
 
 func parseItem(item Item) types.Item {
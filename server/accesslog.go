@@ -0,0 +1,126 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"github.com/Av1shay/di-demo/pkg/types"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// probePaths are polled by load balancers and orchestrators, they are never worth logging.
+var probePaths = []string{"/health-check", "/livez", "/readyz"}
+
+// AccessLogOptions configures the access log of the server.
+type AccessLogOptions struct {
+	// ExcludePaths are not logged in addition to the health check paths, a trailing * matches the paths
+	// starting with the rest.
+	ExcludePaths []string
+	// SlowThreshold logs the requests that take longer as warnings, zero for no warnings.
+	SlowThreshold time.Duration
+}
+
+func WithAccessLog(opts AccessLogOptions) Option {
+	return func(s *Server) {
+		s.accessLog = opts
+	}
+}
+
+type accessLogEntry struct {
+	Method     string
+	Route      string
+	Status     int
+	Bytes      int64
+	Latency    time.Duration
+	RemoteAddr string
+	UserAgent  string
+	AccountID  string
+	UserID     string
+	Slow       bool
+	// Aborted is set when the handler panicked, after which the connection is closed.
+	Aborted bool
+}
+
+func (e accessLogEntry) String() string {
+	route := e.Route
+	if route == "" {
+		// no route matched, the raw path is not logged as it may contain anything
+		route = "-"
+	}
+	return fmt.Sprintf("method=%s route=%s status=%d bytes=%d latency=%s remote_addr=%s user_agent=%q account_id=%s user_id=%s",
+		e.Method, route, e.Status, e.Bytes, e.Latency, e.RemoteAddr, e.UserAgent, e.AccountID, e.UserID)
+}
+
+type accessLogCtxKey struct{}
+
+// setAccessLogUser adds the authenticated user to the access log entry of the request, the entry is created
+// before the user is known.
+func setAccessLogUser(ctx context.Context, user *types.User) {
+	if e, ok := ctx.Value(accessLogCtxKey{}).(*accessLogEntry); ok {
+		e.AccountID = user.AccountID
+		e.UserID = user.ID
+	}
+}
+
+// LogMiddleware logs every request once it completes, with the route pattern instead of the path, which holds
+// item names. Requests slower than the slow threshold and aborted requests are logged as warnings.
+func (s *Server) LogMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.excludedFromAccessLog(r.URL.Path) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		start := time.Now()
+		e := &accessLogEntry{Method: r.Method, RemoteAddr: r.RemoteAddr, UserAgent: r.UserAgent()}
+		ctx := context.WithValue(r.Context(), accessLogCtxKey{}, e)
+		rw := &respWriterWithStatus{ResponseWriter: w, statusCode: http.StatusOK}
+		completed := false
+		// deferred, so the requests aborted by a panic are logged as well
+		defer func() {
+			e.Status = rw.statusCode
+			e.Bytes = rw.bytes
+			e.Latency = time.Since(start).Round(time.Microsecond)
+			e.Slow = s.accessLog.SlowThreshold > 0 && e.Latency > s.accessLog.SlowThreshold
+			e.Aborted = !completed
+			// the route context is shared with the router, which fills in the pattern while routing
+			if rctx := chi.RouteContext(ctx); rctx != nil {
+				e.Route = rctx.RoutePattern()
+			}
+			writeAccessLog(ctx, *e)
+		}()
+		next.ServeHTTP(rw, r.WithContext(ctx))
+		completed = true
+	})
+}
+
+func (s *Server) excludedFromAccessLog(path string) bool {
+	if slices.Contains(probePaths, path) {
+		return true
+	}
+	for _, p := range s.accessLog.ExcludePaths {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+func writeAccessLog(ctx context.Context, e accessLogEntry) {
+	if e.Aborted {
+		log.Warnf(ctx, "Aborted request: %s", e)
+		return
+	}
+	if e.Slow {
+		log.Warnf(ctx, "Slow request: %s", e)
+		return
+	}
+	log.Infof(ctx, "Request: %s", e)
+}
@@ -0,0 +1,219 @@
+package server
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"github.com/go-chi/chi/v5"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// WithAdmin mounts the admin routes under /admin, authenticated with token instead of the user credentials.
+// configView returns the effective configuration shown by GET /admin/config, its secrets must be redacted.
+func WithAdmin(token string, configView func() map[string]any) Option {
+	return func(s *Server) {
+		s.adminToken = token
+		s.adminConfigView = configView
+	}
+}
+
+type cacheToggleInput struct {
+	Enabled *bool `json:"enabled" validate:"required"`
+}
+
+type cacheFlushResult struct {
+	Deleted int `json:"deleted"`
+}
+
+type serverStats struct {
+	Panics uint64 `json:"panics"`
+}
+
+type cacheEntry struct {
+	Key   string `json:"key"`
+	Value any    `json:"value"`
+}
+
+const (
+	// adminMaxFailures is the number of failed admin token attempts a client IP has per adminFailureWindow,
+	// further requests are rejected until the window ends, even with the right token.
+	adminMaxFailures   = 10
+	adminFailureWindow = time.Minute
+)
+
+// authFailureLimiter counts the failed authentication attempts per client IP in fixed windows, in memory.
+type authFailureLimiter struct {
+	mu        sync.Mutex
+	failures  map[string]*authFailures
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type authFailures struct {
+	count int
+	start time.Time
+}
+
+func newAuthFailureLimiter() *authFailureLimiter {
+	return &authFailureLimiter{
+		failures:  make(map[string]*authFailures),
+		lastSweep: time.Now(),
+		now:       time.Now,
+	}
+}
+
+// blocked returns the time until key can try again, zero when it is not blocked.
+func (l *authFailureLimiter) blocked(key string) time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	f, ok := l.failures[key]
+	if !ok || f.count < adminMaxFailures {
+		return 0
+	}
+	return max(f.start.Add(adminFailureWindow).Sub(l.now()), 0)
+}
+
+func (l *authFailureLimiter) fail(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	if now.Sub(l.lastSweep) >= adminFailureWindow {
+		l.lastSweep = now
+		for k, f := range l.failures {
+			if now.Sub(f.start) >= adminFailureWindow {
+				delete(l.failures, k)
+			}
+		}
+	}
+	f, ok := l.failures[key]
+	if !ok || now.Sub(f.start) >= adminFailureWindow {
+		f = &authFailures{start: now}
+		l.failures[key] = f
+	}
+	f.count++
+}
+
+func (s *Server) mountAdminRoutes(r chi.Router) {
+	// admin requests share the public rate limit when one is configured, the failed admin token attempts are
+	// always limited per client IP by AdminAuthMiddleware
+	r.Use(s.RateLimitMiddleware(RateLimitGroupPublic))
+	r.Use(s.AdminAuthMiddleware)
+	r.Get("/cache", s.AdminCacheStatusHandler)
+	r.Put("/cache", s.AdminToggleCacheHandler)
+	r.Delete("/cache/entries", s.AdminFlushCacheHandler)
+	r.Get("/cache/entries/{key}", s.AdminInspectCacheKeyHandler)
+	r.Post("/health-checks", s.AdminHealthCheckHandler)
+	r.Get("/config", s.AdminConfigHandler)
+	r.Get("/stats", s.AdminStatsHandler)
+}
+
+// AdminAuthMiddleware rejects requests without the admin token as bearer token. Client IPs with too many failed
+// attempts are rejected before their token is checked, so the token can't be guessed by brute force.
+func (s *Server) AdminAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := rateLimitKey(r)
+		if wait := s.adminFailures.blocked(key); wait > 0 {
+			retryAfter := max(ceilSeconds(wait), 1)
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+			errorResponse(w, r, errs.NewRateLimitedErr(nil, fmt.Sprintf("Too many failed attempts, retry in %d seconds", retryAfter)))
+			return
+		}
+		token, err := bearerAuthHeader(r.Header.Get("Authorization"))
+		if err == nil && subtle.ConstantTimeCompare([]byte(token), []byte(s.adminToken)) != 1 {
+			err = errors.New("invalid admin token")
+		}
+		if err != nil {
+			s.adminFailures.fail(key)
+			errorResponse(w, r, errs.NewUnauthorizedErr(err, http.StatusText(http.StatusUnauthorized)))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (s *Server) AdminCacheStatusHandler(w http.ResponseWriter, r *http.Request) {
+	successResponse(r.Context(), w, http.StatusOK, s.uamAPI.CacheStatus())
+}
+
+// AdminToggleCacheHandler turns caching on or off in this instance.
+func (s *Server) AdminToggleCacheHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	var input cacheToggleInput
+	if err := decodeJSON(r, &input); err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+	if err := s.validator.Struct(input); err != nil {
+		errorResponse(w, r, validationErr(err))
+		return
+	}
+
+	log.Infof(ctx, "AdminToggleCache enabled: %t", *input.Enabled)
+
+	if err := s.uamAPI.SetCacheEnabled(*input.Enabled); err != nil {
+		errorResponse(w, r, errs.NewBadRequestErr(err, "Can't enable caching, no cache is configured"))
+		return
+	}
+	successResponse(ctx, w, http.StatusOK, s.uamAPI.CacheStatus())
+}
+
+// AdminFlushCacheHandler deletes the cached items and lists of the account_id query param, or of every account
+// when the all query param is true.
+func (s *Server) AdminFlushCacheHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	accountID := r.URL.Query().Get("account_id")
+	all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+	if accountID == "" && !all {
+		errorResponse(w, r, errs.NewBadRequestErr(nil, "account_id is required, set all=true to flush every account"))
+		return
+	}
+
+	log.Infof(ctx, "AdminFlushCache account: %q, all: %t", accountID, all)
+
+	n, err := s.uamAPI.FlushCache(ctx, accountID)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+	successResponse(ctx, w, http.StatusOK, cacheFlushResult{Deleted: n})
+}
+
+func (s *Server) AdminInspectCacheKeyHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	key, err := url.PathUnescape(chi.URLParam(r, "key"))
+	if err != nil {
+		errorResponse(w, r, errs.NewBadRequestErr(err, "Invalid cache key"))
+		return
+	}
+	val, err := s.uamAPI.InspectCacheKey(ctx, key)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+	successResponse(ctx, w, http.StatusOK, cacheEntry{Key: key, Value: val})
+}
+
+// AdminHealthCheckHandler runs the dependency checks now instead of waiting for the next interval, and returns
+// the readiness the way GET /readyz reports it.
+func (s *Server) AdminHealthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	s.runHealthChecks(r.Context())
+	successResponse(r.Context(), w, http.StatusOK, s.readiness())
+}
+
+func (s *Server) AdminConfigHandler(w http.ResponseWriter, r *http.Request) {
+	view := map[string]any{}
+	if s.adminConfigView != nil {
+		view = s.adminConfigView()
+	}
+	successResponse(r.Context(), w, http.StatusOK, view)
+}
+
+func (s *Server) AdminStatsHandler(w http.ResponseWriter, r *http.Request) {
+	successResponse(r.Context(), w, http.StatusOK, serverStats{Panics: s.Panics()})
+}
@@ -0,0 +1,256 @@
+package server
+
+import (
+	"compress/gzip"
+	"context"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	encodingGzip = "gzip"
+	encodingZstd = "zstd"
+
+	// compressMinSize is the body size below which responses are sent uncompressed, as compression does not pay off.
+	compressMinSize = 1024
+)
+
+var (
+	// supportedEncodings are the encodings the server compresses with, in order of preference.
+	supportedEncodings = []string{encodingZstd, encodingGzip}
+
+	gzipWriters = sync.Pool{New: func() any { return gzip.NewWriter(nil) }}
+	// zstdWriters is only used once zstdSupported created an encoder with the same options, it returns nil otherwise.
+	zstdWriters = sync.Pool{New: func() any {
+		zw, err := zstd.NewWriter(nil, zstdWriterOptions...)
+		if err != nil {
+			return nil
+		}
+		return zw
+	}}
+	zstdWriterOptions = []zstd.EOption{zstd.WithEncoderConcurrency(1)}
+
+	// zstdSupported creates the first zstd encoder, zstd is not offered when that fails.
+	zstdSupported = sync.OnceValue(func() bool {
+		zw, err := zstd.NewWriter(nil, zstdWriterOptions...)
+		if err != nil {
+			log.Errorf(context.Background(), "Failed to create zstd encoder, compressing with gzip only: %v", err)
+			return false
+		}
+		zstdWriters.Put(zw)
+		return true
+	})
+)
+
+// CompressMiddleware compresses the responses of clients that accept gzip or zstd. Small bodies, bodies that are
+// compressed already and bodies the handler set a Content-Encoding for are sent as is.
+func CompressMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept-Encoding")
+		encoding := negotiateEncoding(r.Header.Get("Accept-Encoding"), offeredEncodings())
+		if encoding == "" || r.Method == http.MethodHead {
+			next.ServeHTTP(w, r)
+			return
+		}
+		cw := &compressRespWriter{ResponseWriter: w, encoding: encoding, status: http.StatusOK}
+		next.ServeHTTP(cw, r)
+		// not deferred, the response of a panicking handler is left to the recovery middleware
+		cw.close()
+	})
+}
+
+// offeredEncodings returns the supported encodings that are available, in order of preference.
+func offeredEncodings() []string {
+	if zstdSupported() {
+		return supportedEncodings
+	}
+	return []string{encodingGzip}
+}
+
+// negotiateEncoding returns the encoding of encodings with the highest quality in the Accept-Encoding header,
+// or an empty string when the response should not be compressed.
+func negotiateEncoding(header string, encodings []string) string {
+	if header == "" {
+		return ""
+	}
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			var err error
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		qualities[strings.ToLower(strings.TrimSpace(coding))] = q
+	}
+	best, bestQ := "", 0.0
+	for _, enc := range encodings {
+		q, ok := qualities[enc]
+		if !ok {
+			q, ok = qualities["*"]
+		}
+		if ok && q > bestQ {
+			best, bestQ = enc, q
+		}
+	}
+	return best
+}
+
+// compressRespWriter buffers the start of the body until it can tell whether the response is worth compressing.
+// The status code is written to the underlying writer once that is decided, so writers wrapping it see it as is.
+type compressRespWriter struct {
+	http.ResponseWriter
+	encoding    string
+	status      int
+	wroteHeader bool
+	buf         []byte
+	decided     bool
+	enc         io.WriteCloser
+}
+
+func (cw *compressRespWriter) WriteHeader(code int) {
+	if cw.wroteHeader {
+		return
+	}
+	if code >= 100 && code < 200 {
+		cw.ResponseWriter.WriteHeader(code)
+		return
+	}
+	cw.wroteHeader = true
+	cw.status = code
+}
+
+func (cw *compressRespWriter) Write(b []byte) (int, error) {
+	cw.wroteHeader = true
+	if cw.decided {
+		if cw.enc != nil {
+			return cw.enc.Write(b)
+		}
+		return cw.ResponseWriter.Write(b)
+	}
+	cw.buf = append(cw.buf, b...)
+	if len(cw.buf) >= compressMinSize {
+		if err := cw.decide(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(b), nil
+}
+
+// Flush sends the buffered body to the client, streamed responses are compressed regardless of their size.
+func (cw *compressRespWriter) Flush() {
+	if !cw.decided {
+		if err := cw.decide(len(cw.buf) > 0); err != nil {
+			return
+		}
+	}
+	if f, ok := cw.enc.(interface{ Flush() error }); ok {
+		if err := f.Flush(); err != nil {
+			return
+		}
+	}
+	_ = http.NewResponseController(cw.ResponseWriter).Flush()
+}
+
+func (cw *compressRespWriter) Unwrap() http.ResponseWriter {
+	return cw.ResponseWriter
+}
+
+// decide writes the header, compressing the rest of the response when sizeOK and the response is compressible.
+func (cw *compressRespWriter) decide(sizeOK bool) error {
+	cw.decided = true
+	h := cw.Header()
+	if sizeOK && compressible(cw.status, h) {
+		cw.enc = newEncoder(cw.encoding, cw.ResponseWriter)
+	}
+	if cw.enc != nil {
+		h.Del("Content-Length")
+		h.Set("Content-Encoding", cw.encoding)
+		// representations with another content coding need another strong validator (RFC 9110 section 8.8.3)
+		if etag := h.Get("ETag"); etag != "" {
+			h.Set("ETag", encodedETag(etag, cw.encoding))
+		}
+	}
+	cw.ResponseWriter.WriteHeader(cw.status)
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	if cw.enc != nil {
+		_, err := cw.enc.Write(buf)
+		return err
+	}
+	_, err := cw.ResponseWriter.Write(buf)
+	return err
+}
+
+func (cw *compressRespWriter) close() {
+	if !cw.decided {
+		if err := cw.decide(false); err != nil {
+			return
+		}
+	}
+	if cw.enc != nil {
+		_ = cw.enc.Close()
+		putEncoder(cw.enc)
+	}
+}
+
+func compressible(status int, h http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified ||
+		status == http.StatusPartialContent {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(mediaType, "text/"), strings.HasSuffix(mediaType, "+json"), strings.HasSuffix(mediaType, "+xml"):
+		return mediaType != "text/event-stream"
+	}
+	switch mediaType {
+	case "application/json", "application/x-ndjson", "application/xml", "application/javascript":
+		return true
+	}
+	// images, archives and other binary types are compressed already or do not compress well
+	return false
+}
+
+// newEncoder returns nil when no encoder can be created, the response is sent uncompressed then.
+func newEncoder(encoding string, w io.Writer) io.WriteCloser {
+	if encoding == encodingZstd {
+		zw, ok := zstdWriters.Get().(*zstd.Encoder)
+		if !ok {
+			return nil
+		}
+		zw.Reset(w)
+		return zw
+	}
+	gw := gzipWriters.Get().(*gzip.Writer)
+	gw.Reset(w)
+	return gw
+}
+
+func putEncoder(enc io.WriteCloser) {
+	switch e := enc.(type) {
+	case *zstd.Encoder:
+		e.Reset(nil)
+		zstdWriters.Put(e)
+	case *gzip.Writer:
+		e.Reset(nil)
+		gzipWriters.Put(e)
+	}
+}
@@ -0,0 +1,136 @@
+package server
+
+import (
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	defaultCORSMethods = []string{http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch, http.MethodDelete}
+	defaultCORSHeaders = []string{"Authorization", "Content-Type", "If-Match", "If-None-Match", "Idempotency-Key"}
+	// corsExposedHeaders are the response headers set by the server that browsers hide from scripts by default.
+	corsExposedHeaders = strings.Join([]string{
+		"ETag", "Location", "Retry-After", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset",
+		"Idempotent-Replayed", "Deprecation", "Sunset", "Link", "X-Request-ID", "traceresponse",
+	}, ", ")
+)
+
+// CORSOptions configures the cross-origin requests browsers are allowed to make.
+type CORSOptions struct {
+	// AllowedOrigins are the allowed origins, e.g. https://admin.example.com, "*" allows any origin.
+	AllowedOrigins []string
+	// AllowedMethods defaults to GET, POST, PUT, PATCH and DELETE.
+	AllowedMethods []string
+	// AllowedHeaders are the allowed request headers, "*" allows any header. Defaults to the headers of the API.
+	AllowedHeaders []string
+	// AllowCredentials lets browsers send cookies and authorization headers, it must not be combined with the "*"
+	// origin as any site could then make requests with the credentials of its visitors.
+	AllowCredentials bool
+	// MaxAge is how long browsers may cache preflight responses, zero leaves it to the browser.
+	MaxAge time.Duration
+}
+
+// WithCORS allows cross-origin requests from the origins in opts, no cross-origin requests are allowed by default.
+func WithCORS(opts CORSOptions) Option {
+	return func(s *Server) {
+		if len(opts.AllowedMethods) == 0 {
+			opts.AllowedMethods = defaultCORSMethods
+		}
+		if len(opts.AllowedHeaders) == 0 {
+			opts.AllowedHeaders = defaultCORSHeaders
+		}
+		s.cors = &opts
+	}
+}
+
+// CORSMiddleware sets the CORS headers of requests from allowed origins and answers preflight requests,
+// it runs before AuthMiddleware since browsers do not send credentials on preflight.
+func (s *Server) CORSMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if s.cors == nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+		if origin == "" || !s.cors.allowsOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		h := w.Header()
+		if slices.Contains(s.cors.AllowedOrigins, "*") && !s.cors.AllowCredentials {
+			h.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			// credentials can't be allowed for the "*" origin
+			h.Set("Access-Control-Allow-Origin", origin)
+		}
+		if s.cors.AllowCredentials {
+			h.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		if !preflight {
+			h.Set("Access-Control-Expose-Headers", corsExposedHeaders)
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		method := r.Header.Get("Access-Control-Request-Method")
+		reqHeaders := r.Header.Get("Access-Control-Request-Headers")
+		if !slices.Contains(s.cors.AllowedMethods, method) || !s.cors.allowsHeaders(reqHeaders) {
+			h.Del("Access-Control-Allow-Origin")
+			h.Del("Access-Control-Allow-Credentials")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		h.Set("Access-Control-Allow-Methods", strings.Join(s.cors.AllowedMethods, ", "))
+		if reqHeaders != "" {
+			// echo the requested headers, a literal "*" is not supported by browsers with credentials
+			h.Set("Access-Control-Allow-Headers", reqHeaders)
+		}
+		if s.cors.MaxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(s.cors.MaxAge.Seconds())))
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+}
+
+func (o *CORSOptions) allowsOrigin(origin string) bool {
+	for _, allowed := range o.AllowedOrigins {
+		if allowed == "*" || strings.EqualFold(allowed, origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// allowsHeaders reports whether all headers in the comma separated list are allowed.
+func (o *CORSOptions) allowsHeaders(list string) bool {
+	if slices.Contains(o.AllowedHeaders, "*") {
+		return true
+	}
+	for _, name := range strings.Split(list, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if !slices.ContainsFunc(o.AllowedHeaders, func(allowed string) bool {
+			return strings.EqualFold(allowed, name)
+		}) {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+const (
+	defaultMaxBodySize = 1 << 20
+
+	contentTypeJSON = "application/json"
+)
+
+// WithMaxBodySize limits the size of request bodies to n bytes.
+func WithMaxBodySize(n int64) Option {
+	return func(s *Server) {
+		if n > 0 {
+			s.maxBodySize = n
+		}
+	}
+}
+
+// BodyLimitMiddleware makes reading more than the max body size from a request body fail.
+func (s *Server) BodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil && r.Body != http.NoBody {
+			limit := s.maxBodySize
+			if r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, importPath) {
+				// import files are streamed instead of being read in memory
+				limit = s.maxImportSize
+			}
+			r.Body = http.MaxBytesReader(w, r.Body, limit)
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeJSON decodes the body of r, which must be a single JSON value of one of contentTypes (application/json
+// when none are given), into dst. Unknown fields are rejected.
+func decodeJSON(r *http.Request, dst any, contentTypes ...string) error {
+	if len(contentTypes) == 0 {
+		contentTypes = []string{contentTypeJSON}
+	}
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !slices.Contains(contentTypes, mediaType) {
+		return errs.NewAppErr(err, fmt.Sprintf("Content-Type must be %s", strings.Join(contentTypes, " or ")), errs.ErrorCodeMediaType)
+	}
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(dst); err != nil {
+		return decodeErr(err)
+	}
+	if err := dec.Decode(&struct{}{}); !errors.Is(err, io.EOF) {
+		if appErr := bodyTooLargeErr(err); appErr != nil {
+			return appErr
+		}
+		return errs.NewBadRequestErr(err, "Request body must only contain a single JSON value")
+	}
+	return nil
+}
+
+// bodyTooLargeErr returns the error to report when err is caused by a body larger than the max body size, nil otherwise.
+func bodyTooLargeErr(err error) *errs.AppError {
+	var maxBytesErr *http.MaxBytesError
+	if !errors.As(err, &maxBytesErr) {
+		return nil
+	}
+	return errs.NewAppErr(err, fmt.Sprintf("Request body must not be larger than %d bytes", maxBytesErr.Limit), errs.ErrorCodeTooLarge)
+}
+
+// decodeErr converts a json decoding error to an error telling the client what is wrong with the body.
+func decodeErr(err error) error {
+	if appErr := bodyTooLargeErr(err); appErr != nil {
+		return appErr
+	}
+	var (
+		syntaxErr *json.SyntaxError
+		typeErr   *json.UnmarshalTypeError
+	)
+	switch {
+	case errors.As(err, &syntaxErr):
+		return errs.NewBadRequestErr(err, fmt.Sprintf("Request body contains badly-formed JSON (at position %d)", syntaxErr.Offset))
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return errs.NewBadRequestErr(err, "Request body contains badly-formed JSON")
+	case errors.As(err, &typeErr):
+		if typeErr.Field == "" {
+			return errs.NewBadRequestErr(err, fmt.Sprintf("Request body must be a JSON %s", jsonKind(typeErr.Type.Kind().String())))
+		}
+		return errs.NewBadRequestErr(err, fmt.Sprintf("Request body contains an invalid value for the %q field (at position %d)", typeErr.Field, typeErr.Offset))
+	case strings.HasPrefix(err.Error(), "json: unknown field "):
+		return errs.NewBadRequestErr(err, "Request body contains unknown field "+strings.TrimPrefix(err.Error(), "json: unknown field "))
+	case errors.Is(err, io.EOF):
+		return errs.NewBadRequestErr(err, "Request body must not be empty")
+	default:
+		return errs.NewBadRequestErr(err, "Failed to json-decode request")
+	}
+}
+
+func jsonKind(goKind string) string {
+	switch goKind {
+	case "struct", "map":
+		return "object"
+	case "slice", "array":
+		return "array"
+	default:
+		return goKind
+	}
+}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/types"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// itemETag identifies the representation of item, the version changes on every update and the id
+// tells apart items re-created with the same name.
+func itemETag(item types.Item) string {
+	return fmt.Sprintf(`"%s.v%d"`, item.ID, item.Version)
+}
+
+// listETag identifies a list of items by the hash of its content.
+func listETag(items []types.Item) (string, error) {
+	b, err := json.Marshal(items)
+	if err != nil {
+		return "", err
+	}
+	hash := sha256.Sum256(b)
+	return `"` + hex.EncodeToString(hash[:16]) + `"`, nil
+}
+
+// encodedETag returns the tag of the representation of etag compressed with encoding.
+func encodedETag(etag, encoding string) string {
+	if !strings.HasSuffix(etag, `"`) {
+		return etag
+	}
+	return strings.TrimSuffix(etag, `"`) + "-" + encoding + `"`
+}
+
+// decodedETag returns the tag of the uncompressed representation of a tag set by CompressMiddleware.
+func decodedETag(tag string) string {
+	for _, encoding := range supportedEncodings {
+		if t, ok := strings.CutSuffix(tag, "-"+encoding+`"`); ok {
+			return t + `"`
+		}
+	}
+	return tag
+}
+
+// matchingETag returns the tag in the If-None-Match header value that matches etag, using weak comparison.
+// Tags of compressed representations match the tag of the uncompressed one.
+func matchingETag(header, etag string) (string, bool) {
+	for _, tag := range splitETags(header) {
+		if tag == "*" || decodedETag(strings.TrimPrefix(tag, "W/")) == etag {
+			return tag, true
+		}
+	}
+	return "", false
+}
+
+// expectedVersion returns the item version required by the If-Match header value, zero when any version is accepted.
+// It fails when none of the listed entity tags is of the item with id.
+func expectedVersion(header, id string) (int, error) {
+	if header == "" {
+		return 0, nil
+	}
+	for _, tag := range splitETags(header) {
+		if tag == "*" {
+			return 0, nil
+		}
+		// weak tags never match for If-Match
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+		tagID, version, ok := strings.Cut(strings.Trim(decodedETag(tag), `"`), ".v")
+		if !ok || tagID != id {
+			continue
+		}
+		if v, err := strconv.Atoi(version); err == nil && v > 0 {
+			return v, nil
+		}
+	}
+	return 0, errs.NewPreconditionFailedErr(nil, fmt.Sprintf("If-Match does not match the current version of item with id %s", id))
+}
+
+func splitETags(header string) []string {
+	var res []string
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			res = append(res, tag)
+		}
+	}
+	return res
+}
+
+// notModified writes a 304 response when the If-None-Match header of r matches etag, with the tag the client
+// has, which is of the compressed representation when it was sent compressed.
+func notModified(w http.ResponseWriter, r *http.Request, etag string) bool {
+	w.Header().Set("ETag", etag)
+	tag, ok := matchingETag(r.Header.Get("If-None-Match"), etag)
+	if !ok {
+		return false
+	}
+	if tag = strings.TrimPrefix(tag, "W/"); tag != "*" && decodedETag(tag) != tag {
+		w.Header().Set("ETag", tag)
+	}
+	w.WriteHeader(http.StatusNotModified)
+	return true
+}
@@ -0,0 +1,195 @@
+package server
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/authentication"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"github.com/Av1shay/di-demo/pkg/types"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	contentTypeNDJSON = "application/x-ndjson"
+	contentTypeCSV    = "text/csv"
+
+	// exportFlushEvery is the number of items written between flushes of the response.
+	exportFlushEvery = 100
+	// exportWriteTimeout is the time the client has to read every flushed batch, it extends the server write timeout.
+	exportWriteTimeout = 30 * time.Second
+)
+
+var exportCSVHeader = []string{"id", "name", "value", "version", "created_at", "updated_at"}
+
+// itemEncoder writes items in an export format.
+type itemEncoder interface {
+	encode(item types.Item) error
+	// flush writes the items buffered by the encoder.
+	flush() error
+}
+
+// ExportItemsHandler streams every item of the account as NDJSON or CSV, as negotiated from the Accept header.
+func (s *Server) ExportItemsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := authentication.UserFromContext(ctx)
+	if err != nil {
+		errorResponse(w, r, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
+		return
+	}
+
+	contentType := negotiateExportType(r.Header.Get("Accept"))
+	if contentType == "" {
+		errorResponse(w, r, &errs.AppError{
+			Code: errs.ErrorCodeNotAccepted,
+			Msg:  fmt.Sprintf("export is available as %s or %s", contentTypeNDJSON, contentTypeCSV),
+		})
+		return
+	}
+
+	log.Infof(ctx, "ExportItems as %s", contentType)
+
+	rc := http.NewResponseController(w)
+	var (
+		enc   itemEncoder
+		count int
+	)
+	// the response starts with the first item, so errors before it are still sent as an error response
+	start := func() error {
+		ext := "ndjson"
+		if contentType == contentTypeCSV {
+			ext = "csv"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="items.%s"`, ext))
+		w.WriteHeader(http.StatusOK)
+		if contentType == contentTypeCSV {
+			cw := csvItemEncoder{w: csv.NewWriter(w)}
+			if err := cw.w.Write(exportCSVHeader); err != nil {
+				return err
+			}
+			enc = cw
+		} else {
+			enc = ndjsonItemEncoder{enc: json.NewEncoder(w)}
+		}
+		return nil
+	}
+	flush := func() error {
+		if err := enc.flush(); err != nil {
+			return err
+		}
+		// a slow client is fine as long as it keeps reading, the deadline is not supported by every writer
+		_ = rc.SetWriteDeadline(time.Now().Add(exportWriteTimeout))
+		if err := rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		return nil
+	}
+
+	err = s.uamAPI.ExportItems(ctx, user.AccountID, func(item types.Item) error {
+		if enc == nil {
+			if err := start(); err != nil {
+				return err
+			}
+		}
+		if err := enc.encode(item); err != nil {
+			return err
+		}
+		if count++; count%exportFlushEvery == 0 {
+			return flush()
+		}
+		return nil
+	})
+	if err != nil {
+		if enc == nil {
+			errorResponse(w, r, err)
+			return
+		}
+		// the status was sent already, abort the response so the client sees it is incomplete
+		log.Errorf(ctx, "Failed to export items after %d items: %v", count, err)
+		panic(http.ErrAbortHandler)
+	}
+	if enc == nil {
+		if err := start(); err != nil {
+			log.Errorf(ctx, "Failed to write export: %v", err)
+			return
+		}
+	}
+	if err := enc.flush(); err != nil {
+		log.Errorf(ctx, "Failed to write export: %v", err)
+		return
+	}
+	log.Infof(ctx, "Exported %d items", count)
+}
+
+// negotiateExportType returns the export content type with the highest quality in the Accept header,
+// NDJSON when the header is missing and an empty string when no export type is acceptable.
+func negotiateExportType(accept string) string {
+	if strings.TrimSpace(accept) == "" {
+		return contentTypeNDJSON
+	}
+	best, bestQ := "", 0.0
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		var contentType string
+		switch mediaType {
+		case contentTypeNDJSON, "application/*", "*/*":
+			contentType = contentTypeNDJSON
+		case contentTypeCSV, "text/*":
+			contentType = contentTypeCSV
+		default:
+			continue
+		}
+		if q > bestQ {
+			best, bestQ = contentType, q
+		}
+	}
+	return best
+}
+
+type ndjsonItemEncoder struct {
+	enc *json.Encoder
+}
+
+func (e ndjsonItemEncoder) encode(item types.Item) error {
+	return e.enc.Encode(item)
+}
+
+func (e ndjsonItemEncoder) flush() error {
+	return nil
+}
+
+type csvItemEncoder struct {
+	w *csv.Writer
+}
+
+func (e csvItemEncoder) encode(item types.Item) error {
+	return e.w.Write([]string{
+		item.ID,
+		item.Name,
+		item.Value,
+		strconv.Itoa(item.Version),
+		item.CreatedAt.UTC().Format(time.RFC3339Nano),
+		item.UpdatedAt.UTC().Format(time.RFC3339Nano),
+	})
+}
+
+func (e csvItemEncoder) flush() error {
+	e.w.Flush()
+	return e.w.Error()
+}
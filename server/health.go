@@ -0,0 +1,168 @@
+package server
+
+import (
+	"context"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultHealthCheckInterval = time.Second
+	defaultHealthCheckTimeout  = 5 * time.Second
+
+	checkStatusOK      = "ok"
+	checkStatusFailing = "failing"
+	checkStatusPending = "pending"
+
+	readinessOK           = "ok"
+	readinessStarting     = "starting"
+	readinessShuttingDown = "shutting_down"
+	readinessUnhealthy    = "unhealthy"
+)
+
+// CheckFunc checks a dependency of the server, it returns an error when the dependency is not usable.
+type CheckFunc func(ctx context.Context) error
+
+type healthCheck struct {
+	name     string
+	critical bool
+	check    CheckFunc
+}
+
+type checkResult struct {
+	Status      string     `json:"status"`
+	Critical    bool       `json:"critical"`
+	LatencyMS   int64      `json:"latency_ms"`
+	CheckedAt   *time.Time `json:"checked_at,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+}
+
+type readinessBody struct {
+	Status string                 `json:"status"`
+	Checks map[string]checkResult `json:"checks"`
+}
+
+// WithHealthCheck adds a dependency check to the readiness check, the server is not ready while a critical check fails.
+// The repository and the cache are always checked, the cache is not critical as requests fall back to the repository.
+func WithHealthCheck(name string, critical bool, check CheckFunc) Option {
+	return func(s *Server) {
+		s.healthChecks = append(s.healthChecks, healthCheck{name: name, critical: critical, check: check})
+	}
+}
+
+// WithHealthCheckConfig sets how often the dependencies are checked and the time every check has to complete,
+// zero keeps the default.
+func WithHealthCheckConfig(interval, timeout time.Duration) Option {
+	return func(s *Server) {
+		if interval > 0 {
+			s.healthInterval = interval
+		}
+		if timeout > 0 {
+			s.healthTimeout = timeout
+		}
+	}
+}
+
+func (s *Server) startHealthCheck(ctx context.Context) {
+	s.runHealthChecks(ctx)
+
+	ticker := time.NewTicker(s.healthInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.runHealthChecks(ctx)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// runHealthChecks runs all the checks concurrently and stores their results.
+func (s *Server) runHealthChecks(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, hc := range s.healthChecks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, s.healthTimeout)
+			defer cancel()
+
+			start := time.Now()
+			err := hc.check(ctx)
+			latency := time.Since(start)
+			if err != nil {
+				log.Errorf(ctx, "Health check %s failed: %v", hc.name, err)
+			}
+			s.healthMu.Lock()
+			defer s.healthMu.Unlock()
+			res := s.healthResults[hc.name]
+			res.Status = checkStatusOK
+			res.Critical = hc.critical
+			res.LatencyMS = latency.Milliseconds()
+			res.CheckedAt = &start
+			if err != nil {
+				res.Status = checkStatusFailing
+				res.LastError = err.Error()
+				res.LastErrorAt = &start
+			}
+			s.healthResults[hc.name] = res
+		}()
+	}
+	wg.Wait()
+}
+
+// readiness returns the readiness status of the server with the results of the checks.
+func (s *Server) readiness() readinessBody {
+	s.healthMu.RLock()
+	defer s.healthMu.RUnlock()
+
+	body := readinessBody{Status: readinessOK, Checks: make(map[string]checkResult, len(s.healthChecks))}
+	for _, hc := range s.healthChecks {
+		res, ok := s.healthResults[hc.name]
+		if !ok {
+			res = checkResult{Status: checkStatusPending, Critical: hc.critical}
+		}
+		body.Checks[hc.name] = res
+		if hc.critical && res.Status != checkStatusOK {
+			body.Status = readinessUnhealthy
+		}
+	}
+	switch {
+	case s.shuttingDown.Load():
+		body.Status = readinessShuttingDown
+	case !s.ready.Load():
+		body.Status = readinessStarting
+	}
+	return body
+}
+
+// LivenessHandler reports the process is up, it does not check the dependencies so it does not get restarted
+// when they are down.
+func (s *Server) LivenessHandler(w http.ResponseWriter, r *http.Request) {
+	successResponse(r.Context(), w, http.StatusOK, map[string]string{"status": checkStatusOK})
+}
+
+// ReadinessHandler reports whether the server is ready to take traffic, with the results of the dependency checks.
+func (s *Server) ReadinessHandler(w http.ResponseWriter, r *http.Request) {
+	body := s.readiness()
+	status := http.StatusOK
+	if body.Status != readinessOK {
+		status = http.StatusServiceUnavailable
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	successResponse(r.Context(), w, status, body)
+}
+
+// HealthCheckHandler is the readiness check without a body, kept for existing load balancer configurations.
+func (s *Server) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
+	if s.readiness().Status == readinessOK {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	w.WriteHeader(http.StatusServiceUnavailable)
+}
@@ -0,0 +1,200 @@
+package server
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/authentication"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"github.com/Av1shay/di-demo/uam"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+const (
+	defaultIdempotencyTTL = 24 * time.Hour
+	maxIdempotencyKeyLen  = 255
+)
+
+// replayedHeaders are the response headers stored with the response of an idempotent request.
+var replayedHeaders = []string{"Content-Type", "ETag", "Location"}
+
+// WithIdempotency stores the responses of mutating requests sent with an Idempotency-Key header in store for ttl,
+// and replays them to retries of the same request.
+func WithIdempotency(store uam.Cache, ttl time.Duration) Option {
+	return func(s *Server) {
+		if ttl <= 0 {
+			ttl = defaultIdempotencyTTL
+		}
+		s.idempotencyStore = store
+		s.idempotencyTTL = ttl
+	}
+}
+
+type idempotencyRecord struct {
+	RequestHash string              `json:"request_hash"`
+	Status      int                 `json:"status"`
+	Header      map[string][]string `json:"header"`
+	Body        []byte              `json:"body"`
+}
+
+// IdempotencyMiddleware replays the stored response of a request when it is retried with the same Idempotency-Key
+// by the same account, and rejects the reuse of a key for a different request. Server errors are not stored, so
+// such requests can be retried.
+func (s *Server) IdempotencyMiddleware(next http.Handler) http.Handler {
+	if s.idempotencyStore == nil {
+		return next
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		key := r.Header.Get("Idempotency-Key")
+		if key == "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if len(key) > maxIdempotencyKeyLen {
+			errorResponse(w, r, errs.NewBadRequestErr(nil, fmt.Sprintf("Idempotency-Key must be at most %d characters", maxIdempotencyKeyLen)))
+			return
+		}
+		user, err := authentication.UserFromContext(ctx)
+		if err != nil {
+			errorResponse(w, r, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
+			return
+		}
+
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			if appErr := bodyTooLargeErr(err); appErr != nil {
+				errorResponse(w, r, appErr)
+				return
+			}
+			errorResponse(w, r, errs.NewBadRequestErr(err, "Failed to read request body"))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
+		reqHash := idempotencyRequestHash(r, body)
+
+		storeKey := fmt.Sprintf("idempotency:%s:%s", user.AccountID, key)
+		unlock := s.idempotencyLocks.lock(storeKey)
+		defer unlock()
+
+		var rec idempotencyRecord
+		err = s.idempotencyStore.Get(ctx, storeKey, &rec)
+		if err == nil {
+			if rec.RequestHash != reqHash {
+				errorResponse(w, r, errs.NewAppErr(nil, "Idempotency-Key was already used for a different request", errs.ErrorCodeIdempotency))
+				return
+			}
+			for k, v := range rec.Header {
+				w.Header()[k] = v
+			}
+			w.Header().Set("Idempotent-Replayed", "true")
+			w.WriteHeader(rec.Status)
+			_, _ = w.Write(rec.Body)
+			return
+		}
+		if !errors.Is(err, cache.ErrCacheMiss) {
+			log.Errorf(ctx, "Failed to get idempotency record %s: %v", key, err)
+		}
+
+		rw := &recordingRespWriter{ResponseWriter: w}
+		next.ServeHTTP(rw, r)
+
+		if rw.status == 0 {
+			// the handler wrote nothing, net/http responds with 200 and an empty body
+			rw.status = http.StatusOK
+		}
+		if rw.status >= http.StatusInternalServerError {
+			return
+		}
+		rec = idempotencyRecord{
+			RequestHash: reqHash,
+			Status:      rw.status,
+			Header:      make(map[string][]string),
+			Body:        rw.body.Bytes(),
+		}
+		for _, h := range replayedHeaders {
+			if v := w.Header().Values(h); len(v) > 0 {
+				rec.Header[h] = v
+			}
+		}
+		if err := s.idempotencyStore.Set(ctx, storeKey, rec, s.idempotencyTTL); err != nil {
+			log.Errorf(ctx, "Failed to store idempotency record %s: %v", key, err)
+		}
+	})
+}
+
+func idempotencyRequestHash(r *http.Request, body []byte) string {
+	h := sha256.New()
+	h.Write([]byte(r.Method + " " + r.URL.Path + "\n"))
+	h.Write(body)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// recordingRespWriter keeps a copy of the response written through it.
+type recordingRespWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (rw *recordingRespWriter) WriteHeader(code int) {
+	if rw.status == 0 {
+		rw.status = code
+	}
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recordingRespWriter) Write(b []byte) (int, error) {
+	if rw.status == 0 {
+		rw.status = http.StatusOK
+	}
+	rw.body.Write(b)
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the Flush and deadline methods of the underlying writer.
+func (rw *recordingRespWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
+// keyedMutex serializes the requests using the same idempotency key in this instance.
+type keyedMutex struct {
+	mu    sync.Mutex
+	locks map[string]*keyedLock
+}
+
+type keyedLock struct {
+	mu   sync.Mutex
+	refs int
+}
+
+func (km *keyedMutex) lock(key string) func() {
+	km.mu.Lock()
+	if km.locks == nil {
+		km.locks = make(map[string]*keyedLock)
+	}
+	l, ok := km.locks[key]
+	if !ok {
+		l = &keyedLock{}
+		km.locks[key] = l
+	}
+	l.refs++
+	km.mu.Unlock()
+
+	l.mu.Lock()
+	return func() {
+		l.mu.Unlock()
+		km.mu.Lock()
+		if l.refs--; l.refs == 0 {
+			delete(km.locks, key)
+		}
+		km.mu.Unlock()
+	}
+}
@@ -0,0 +1,282 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/authentication"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"github.com/Av1shay/di-demo/pkg/types"
+	"io"
+	"mime"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultMaxImportSize = 64 << 20
+
+	importPath = "/items/import"
+	// importChunkSize is the number of rows imported together through the uam.API.
+	importChunkSize = 100
+
+	// importMaxLineSize is the max size of an NDJSON line.
+	importMaxLineSize = 1 << 20
+
+	// importChunkTimeout is the time to upload and import every chunk of rows, it extends the server read and write
+	// timeouts, which would otherwise have to cover the whole upload.
+	importChunkTimeout = time.Minute
+)
+
+// WithMaxImportSize limits the size of uploaded import files to n bytes, instead of the max body size.
+func WithMaxImportSize(n int64) Option {
+	return func(s *Server) {
+		if n > 0 {
+			s.maxImportSize = n
+		}
+	}
+}
+
+// importRowReader reads the rows of an uploaded file, it returns io.EOF after the last row.
+type importRowReader interface {
+	next() (types.ImportRow, error)
+	// line is the line reading failed at.
+	line() int
+}
+
+// importRowErr is returned by an importRowReader for an invalid row, the rows after it can still be read.
+type importRowErr struct {
+	line int
+	msg  string
+}
+
+func (e *importRowErr) Error() string {
+	return fmt.Sprintf("line %d: %s", e.line, e.msg)
+}
+
+// ImportItemsHandler creates the items of an uploaded NDJSON or CSV file in chunks, rows with the name of an existing
+// item are handled by the on_conflict policy. It responds with a summary of the rows that were not created.
+func (s *Server) ImportItemsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := authentication.UserFromContext(ctx)
+	if err != nil {
+		errorResponse(w, r, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
+		return
+	}
+
+	input := types.ImportItemsInput{Policy: types.ImportPolicy(r.URL.Query().Get("on_conflict"))}
+	if err := s.validator.Struct(&input); err != nil {
+		errorResponse(w, r, validationErr(err))
+		return
+	}
+	if input.Policy == "" {
+		input.Policy = types.ImportPolicyFail
+	}
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || (mediaType != contentTypeNDJSON && mediaType != contentTypeCSV) {
+		errorResponse(w, r, errs.NewAppErr(err, fmt.Sprintf("Content-Type must be %s or %s", contentTypeNDJSON, contentTypeCSV),
+			errs.ErrorCodeMediaType))
+		return
+	}
+	rc := http.NewResponseController(w)
+	extendDeadlines := func() {
+		// the deadlines are not supported by every writer
+		deadline := time.Now().Add(importChunkTimeout)
+		_ = rc.SetReadDeadline(deadline)
+		_ = rc.SetWriteDeadline(deadline)
+	}
+	extendDeadlines()
+
+	var rows importRowReader
+	if mediaType == contentTypeCSV {
+		if rows, err = newCSVRowReader(r.Body); err != nil {
+			errorResponse(w, r, err)
+			return
+		}
+	} else {
+		rows = newNDJSONRowReader(r.Body)
+	}
+
+	log.Infof(ctx, "ImportItems from %s with policy: %s", mediaType, input.Policy)
+
+	var sum types.ImportSummary
+	input.Rows = make([]types.ImportRow, 0, importChunkSize)
+	importChunk := func() error {
+		extendDeadlines()
+		if len(input.Rows) == 0 {
+			return nil
+		}
+		res, err := s.uamAPI.ImportItems(ctx, input, user.AccountID)
+		sum.Merge(res)
+		input.Rows = input.Rows[:0]
+		return err
+	}
+	// the chunk is imported before a failed row is reported, so the rows are reported in file order
+	// and nothing after the row that aborted the import is reported
+	failRow := func(res types.ImportRowResult) error {
+		if err := importChunk(); err != nil || sum.Aborted {
+			return err
+		}
+		sum.AddRow(res)
+		return nil
+	}
+
+	status := http.StatusOK
+	for !sum.Aborted {
+		row, err := rows.next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		var rowErr *importRowErr
+		if errors.As(err, &rowErr) {
+			err = failRow(types.ImportRowResult{Line: rowErr.line, Status: types.ImportRowFailed, Error: rowErr.msg})
+		} else if err != nil {
+			// the rest of the file can't be read, the rows before it are still imported
+			res := types.ImportRowResult{Line: rows.line(), Status: types.ImportRowFailed, Error: err.Error()}
+			readStatus := http.StatusBadRequest
+			if appErr := bodyTooLargeErr(err); appErr != nil {
+				res.Error = appErr.Msg
+				readStatus = http.StatusRequestEntityTooLarge
+			}
+			if err = failRow(res); err == nil && !sum.Aborted {
+				sum.Aborted = true
+				status = readStatus
+			}
+		} else if vErr := s.validator.Struct(&row); vErr != nil {
+			err = failRow(types.ImportRowResult{Line: row.Line, Name: row.Name, Status: types.ImportRowFailed,
+				Error: validationErr(vErr).Msg})
+		} else {
+			input.Rows = append(input.Rows, row)
+			if len(input.Rows) == importChunkSize {
+				err = importChunk()
+			}
+		}
+		if err != nil {
+			errorResponse(w, r, err)
+			return
+		}
+	}
+	if err := importChunk(); err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+	if sum.Aborted && status == http.StatusOK {
+		status = http.StatusConflict
+	}
+
+	log.Infof(ctx, "Imported items, created: %d, updated: %d, skipped: %d, failed: %d, aborted: %t",
+		sum.Created, sum.Updated, sum.Skipped, sum.Failed, sum.Aborted)
+
+	respond(w, r, status, sum)
+}
+
+type ndjsonRowReader struct {
+	sc      *bufio.Scanner
+	lineNum int
+}
+
+func newNDJSONRowReader(body io.Reader) *ndjsonRowReader {
+	sc := bufio.NewScanner(body)
+	sc.Buffer(make([]byte, 0, 64<<10), importMaxLineSize)
+	return &ndjsonRowReader{sc: sc}
+}
+
+func (rr *ndjsonRowReader) next() (types.ImportRow, error) {
+	for rr.sc.Scan() {
+		rr.lineNum++
+		b := bytes.TrimSpace(rr.sc.Bytes())
+		if len(b) == 0 {
+			continue
+		}
+		// fields other than name and value are ignored, so exported files can be imported back
+		var input types.ItemCreateInput
+		if err := json.Unmarshal(b, &input); err != nil {
+			msg := err.Error()
+			var appErr *errs.AppError
+			if errors.As(decodeErr(err), &appErr) {
+				msg = appErr.Msg
+			}
+			return types.ImportRow{}, &importRowErr{line: rr.lineNum, msg: msg}
+		}
+		return types.ImportRow{Line: rr.lineNum, ItemCreateInput: input}, nil
+	}
+	if err := rr.sc.Err(); err != nil {
+		if errors.Is(err, bufio.ErrTooLong) {
+			return types.ImportRow{}, fmt.Errorf("line is longer than %d bytes", importMaxLineSize)
+		}
+		return types.ImportRow{}, err
+	}
+	return types.ImportRow{}, io.EOF
+}
+
+// line is the line after the last line read, where reading failed.
+func (rr *ndjsonRowReader) line() int {
+	return rr.lineNum + 1
+}
+
+type csvRowReader struct {
+	r        *csv.Reader
+	nameCol  int
+	valueCol int
+	lineNum  int
+}
+
+// newCSVRowReader reads the header row, which must have a name column. Columns other than name and value are ignored,
+// so exported files can be imported back.
+func newCSVRowReader(body io.Reader) (*csvRowReader, error) {
+	r := csv.NewReader(body)
+	r.ReuseRecord = true
+	header, err := r.Read()
+	if err != nil {
+		if appErr := bodyTooLargeErr(err); appErr != nil {
+			return nil, appErr
+		}
+		return nil, errs.NewBadRequestErr(err, "CSV file must start with a header row")
+	}
+	for i := range header {
+		header[i] = strings.ToLower(strings.TrimSpace(header[i]))
+	}
+	rr := &csvRowReader{
+		r:        r,
+		nameCol:  slices.Index(header, "name"),
+		valueCol: slices.Index(header, "value"),
+		lineNum:  1,
+	}
+	if rr.nameCol < 0 {
+		return nil, errs.NewBadRequestErr(nil, "CSV header row must have a name column")
+	}
+	return rr, nil
+}
+
+func (rr *csvRowReader) next() (types.ImportRow, error) {
+	record, err := rr.r.Read()
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rr.lineNum = parseErr.StartLine - 1
+			if errors.Is(parseErr.Err, csv.ErrFieldCount) {
+				return types.ImportRow{}, &importRowErr{line: parseErr.StartLine, msg: "wrong number of fields"}
+			}
+		}
+		return types.ImportRow{}, err
+	}
+	rr.lineNum, _ = rr.r.FieldPos(0)
+	row := types.ImportRow{Line: rr.lineNum}
+	row.Name = record[rr.nameCol]
+	if rr.valueCol >= 0 {
+		row.Value = record[rr.valueCol]
+	}
+	return row, nil
+}
+
+// line is the line after the last line read, where reading failed.
+func (rr *csvRowReader) line() int {
+	return rr.lineNum + 1
+}
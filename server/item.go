@@ -15,86 +15,161 @@ func (s *Server) GetItemByNameHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, err := authentication.UserFromContext(ctx)
 	if err != nil {
-		errorResponse(ctx, w, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
+		errorResponse(w, r, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
 		return
 	}
 	name := chi.URLParam(r, "name")
 	item, err := s.uamAPI.GetItemByName(ctx, name, user.AccountID)
 	if err != nil {
-		errorResponse(ctx, w, err)
+		errorResponse(w, r, err)
 		return
 	}
-	successResponse(ctx, w, http.StatusOK, item)
+	if notModified(w, r, itemETag(item)) {
+		return
+	}
+	respond(w, r, http.StatusOK, item)
 }
 
 func (s *Server) AddItemHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, err := authentication.UserFromContext(ctx)
 	if err != nil {
-		errorResponse(ctx, w, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
+		errorResponse(w, r, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
 		return
 	}
 
 	var input types.ItemCreateInput
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		errorResponse(ctx, w, errs.NewBadRequestErr(err, "Failed to json-decode request"))
+	if err := decodeJSON(r, &input); err != nil {
+		errorResponse(w, r, err)
 		return
 	}
 
 	log.Infof(ctx, "AddItem with input: %+v", input)
 
 	if err := s.validator.Struct(&input); err != nil {
-		errorResponse(ctx, w, errs.NewBadRequestErr(err, ""))
+		errorResponse(w, r, validationErr(err))
 		return
 	}
 	item, err := s.uamAPI.CreateItem(ctx, input, user.AccountID)
 	if err != nil {
-		errorResponse(ctx, w, err)
+		errorResponse(w, r, err)
 		return
 	}
 
-	successResponse(ctx, w, http.StatusCreated, item)
+	respond(w, r, http.StatusCreated, item)
 }
 
 func (s *Server) UpdateItemHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, err := authentication.UserFromContext(ctx)
 	if err != nil {
-		errorResponse(ctx, w, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
+		errorResponse(w, r, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
 		return
 	}
 
 	id := chi.URLParam(r, "id")
 
 	var input types.UpdateItemInput
-	if err := json.NewDecoder(r.Body).Decode(&input); err != nil {
-		errorResponse(ctx, w, errs.NewBadRequestErr(err, "Failed to json-decode request"))
+	if err := decodeJSON(r, &input); err != nil {
+		errorResponse(w, r, err)
 		return
 	}
 
 	log.Infof(ctx, "UpdateItem with input: %+v", input)
 
 	if err := s.validator.Struct(&input); err != nil {
-		errorResponse(ctx, w, errs.NewBadRequestErr(err, ""))
+		errorResponse(w, r, validationErr(err))
 		return
 	}
 
 	input.ID = id
+	input.ExpectedVersion, err = expectedVersion(r.Header.Get("If-Match"), id)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
 
 	item, err := s.uamAPI.UpdateItem(ctx, input, user.AccountID)
 	if err != nil {
-		errorResponse(ctx, w, err)
+		errorResponse(w, r, err)
 		return
 	}
 
-	successResponse(ctx, w, http.StatusOK, item)
+	w.Header().Set("ETag", itemETag(item))
+
+	respond(w, r, http.StatusOK, item)
+}
+
+func (s *Server) PatchItemHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := authentication.UserFromContext(ctx)
+	if err != nil {
+		errorResponse(w, r, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
+		return
+	}
+
+	id := chi.URLParam(r, "id")
+
+	var input types.PatchItemInput
+	if isJSONPatch(r) {
+		var ops []jsonPatchOp
+		if err := decodeJSON(r, &ops, contentTypeJSONPatch); err != nil {
+			errorResponse(w, r, err)
+			return
+		}
+		input, err = applyJSONPatch(ops, func() (types.Item, error) {
+			return s.uamAPI.GetItem(ctx, id, user.AccountID)
+		})
+	} else {
+		var doc map[string]json.RawMessage
+		if err := decodeJSON(r, &doc, contentTypeMergePatch); err != nil {
+			errorResponse(w, r, err)
+			return
+		}
+		input, err = applyMergePatch(doc)
+	}
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+
+	log.Infof(ctx, "PatchItem with id: %s", id)
+
+	if err := s.validator.Struct(&input); err != nil {
+		errorResponse(w, r, validationErr(err))
+		return
+	}
+
+	input.ID = id
+	version, err := expectedVersion(r.Header.Get("If-Match"), id)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+	if version > 0 {
+		if input.ExpectedVersion > 0 && input.ExpectedVersion != version {
+			errorResponse(w, r, errs.NewPreconditionFailedErr(nil, "If-Match does not match the version tested by the patch"))
+			return
+		}
+		input.ExpectedVersion = version
+	}
+
+	item, err := s.uamAPI.PatchItem(ctx, input, user.AccountID)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", itemETag(item))
+
+	respond(w, r, http.StatusOK, item)
 }
 
 func (s *Server) ListItemsHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, err := authentication.UserFromContext(ctx)
 	if err != nil {
-		errorResponse(ctx, w, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
+		errorResponse(w, r, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
 		return
 	}
 
@@ -108,24 +183,33 @@ func (s *Server) ListItemsHandler(w http.ResponseWriter, r *http.Request) {
 	log.Infof(ctx, "ListItems with input: %+v", input)
 
 	if err := s.validator.Struct(&input); err != nil {
-		errorResponse(ctx, w, errs.NewBadRequestErr(err, ""))
+		errorResponse(w, r, validationErr(err))
 		return
 	}
 
 	items, err := s.uamAPI.ListItems(ctx, input, user.AccountID)
 	if err != nil {
-		errorResponse(ctx, w, err)
+		errorResponse(w, r, err)
 		return
 	}
 
-	successResponse(ctx, w, http.StatusOK, items)
+	etag, err := listETag(items)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+	if notModified(w, r, etag) {
+		return
+	}
+
+	respond(w, r, http.StatusOK, items)
 }
 
 func (s *Server) DeleteItemHandler(w http.ResponseWriter, r *http.Request) {
 	ctx := r.Context()
 	user, err := authentication.UserFromContext(ctx)
 	if err != nil {
-		errorResponse(ctx, w, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
+		errorResponse(w, r, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
 		return
 	}
 
@@ -133,8 +217,14 @@ func (s *Server) DeleteItemHandler(w http.ResponseWriter, r *http.Request) {
 
 	log.Infof(ctx, "DeleteItem with id: %s", id)
 
-	if err := s.uamAPI.DeleteItem(ctx, id, user.AccountID); err != nil {
-		errorResponse(ctx, w, err)
+	version, err := expectedVersion(r.Header.Get("If-Match"), id)
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+
+	if err := s.uamAPI.DeleteItem(ctx, types.DeleteItemInput{ID: id, ExpectedVersion: version}, user.AccountID); err != nil {
+		errorResponse(w, r, err)
 		return
 	}
 
@@ -2,9 +2,8 @@ package server
 
 import (
 	"errors"
+	"github.com/Av1shay/di-demo/authentication"
 	"github.com/Av1shay/di-demo/pkg/errs"
-	"github.com/Av1shay/di-demo/pkg/log"
-	"github.com/google/uuid"
 	"net/http"
 	"strings"
 )
@@ -12,6 +11,7 @@ import (
 type respWriterWithStatus struct {
 	http.ResponseWriter
 	statusCode int
+	bytes      int64
 }
 
 func (rw *respWriterWithStatus) WriteHeader(code int) {
@@ -19,24 +19,15 @@ func (rw *respWriterWithStatus) WriteHeader(code int) {
 	rw.ResponseWriter.WriteHeader(code)
 }
 
-func TraceIDMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		traceID := uuid.NewString()
-		ctx := log.ContextWithTraceID(r.Context(), traceID)
-		next.ServeHTTP(w, r.WithContext(ctx))
-	})
+func (rw *respWriterWithStatus) Write(b []byte) (int, error) {
+	n, err := rw.ResponseWriter.Write(b)
+	rw.bytes += int64(n)
+	return n, err
 }
 
-func LogMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/health-check" {
-			next.ServeHTTP(w, r)
-			return
-		}
-		rw := &respWriterWithStatus{ResponseWriter: w, statusCode: http.StatusOK}
-		next.ServeHTTP(rw, r)
-		log.Infof(r.Context(), "Request: method=%s path=%s status=%d", r.Method, r.URL.Path, rw.statusCode)
-	})
+// Unwrap lets http.ResponseController reach the Flush and deadline methods of the underlying writer.
+func (rw *respWriterWithStatus) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
 }
 
 func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
@@ -44,15 +35,18 @@ func (s *Server) AuthMiddleware(next http.Handler) http.Handler {
 		ctx := r.Context()
 		token, err := bearerAuthHeader(r.Header.Get("Authorization"))
 		if err != nil {
-			errorResponse(ctx, w, errs.NewUnauthorizedErr(err, http.StatusText(http.StatusUnauthorized)))
+			errorResponse(w, r, errs.NewUnauthorizedErr(err, http.StatusText(http.StatusUnauthorized)))
 			return
 		}
 
 		ctx, err = s.auth.ContextWithUserAuth(ctx, token)
 		if err != nil {
-			errorResponse(ctx, w, errs.NewUnauthorizedErr(err, http.StatusText(http.StatusUnauthorized)))
+			errorResponse(w, r, errs.NewUnauthorizedErr(err, http.StatusText(http.StatusUnauthorized)))
 			return
 		}
+		if user, err := authentication.UserFromContext(ctx); err == nil {
+			setAccessLogUser(ctx, user)
+		}
 
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//go:embed openapi.json
+var openAPISpec []byte
+
+// openAPIDocument is the served OpenAPI document, with the deprecated root aliases.
+var openAPIDocument = sync.OnceValues(func() ([]byte, error) {
+	doc, err := loadOpenAPIDoc(context.Background())
+	if err != nil {
+		return nil, err
+	}
+	return json.MarshalIndent(doc, "", "  ")
+})
+
+func init() {
+	openapi3filter.RegisterBodyDecoder(contentTypeMergePatch, openapi3filter.JSONBodyDecoder)
+}
+
+func loadOpenAPIDoc(ctx context.Context) (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(openAPISpec)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load openapi document: %w", err)
+	}
+	addRootAliases(doc)
+	if err := doc.Validate(ctx); err != nil {
+		return nil, fmt.Errorf("invalid openapi document: %w", err)
+	}
+	return doc, nil
+}
+
+// addRootAliases documents the deprecated root routes as copies of the /v1 operations, so they can't drift apart.
+func addRootAliases(doc *openapi3.T) {
+	prefix := "/" + apiV1.name
+	for _, path := range doc.Paths.InMatchingOrder() {
+		rootPath, ok := strings.CutPrefix(path, prefix)
+		if !ok || !strings.HasPrefix(rootPath, "/") {
+			continue
+		}
+		item := doc.Paths.Value(path)
+		alias := *item
+		for method, op := range item.Operations() {
+			aliasOp := *op
+			aliasOp.OperationID += "Deprecated"
+			aliasOp.Deprecated = true
+			aliasOp.Description = fmt.Sprintf("Deprecated alias of `%s %s`, responses have `Deprecation`, `Sunset` and `Link` headers.",
+				method, path)
+			alias.SetOperation(method, &aliasOp)
+		}
+		doc.Paths.Set(rootPath, &alias)
+	}
+}
+
+func newOpenAPIRouter(ctx context.Context) (routers.Router, error) {
+	doc, err := loadOpenAPIDoc(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return gorillamux.NewRouter(doc)
+}
+
+func (s *Server) OpenAPIHandler(w http.ResponseWriter, r *http.Request) {
+	doc, err := openAPIDocument()
+	if err != nil {
+		errorResponse(w, r, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	_, _ = w.Write(doc)
+}
+
+// OpenAPIValidationMiddleware rejects requests that do not match the OpenAPI document.
+// Requests to routes missing from the document are passed through to the router.
+func (s *Server) OpenAPIValidationMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		route, pathParams, err := s.openAPIRouter.FindRoute(r)
+		if err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+		err = openapi3filter.ValidateRequest(ctx, &openapi3filter.RequestValidationInput{
+			Request:    r,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				// authentication is done by AuthMiddleware
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+				// streamed bodies would be read in memory, their handlers validate them as they are read
+				ExcludeRequestBody: isStreamedBody(r),
+			},
+		})
+		if err != nil {
+			if appErr := bodyTooLargeErr(err); appErr != nil {
+				errorResponse(w, r, appErr)
+				return
+			}
+			errorResponse(w, r, openAPIErr(err))
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func isStreamedBody(r *http.Request) bool {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && (mediaType == contentTypeNDJSON || mediaType == contentTypeCSV)
+}
+
+// openAPIErr converts a request validation error to a validation error with the invalid field details.
+func openAPIErr(err error) *errs.AppError {
+	var reqErr *openapi3filter.RequestError
+	if !errors.As(err, &reqErr) {
+		return errs.NewBadRequestErr(err, err.Error())
+	}
+	if reqErr.RequestBody != nil && (strings.HasPrefix(reqErr.Reason, "header Content-Type has unexpected value") ||
+		strings.HasPrefix(reqErr.Reason, "unsupported content type")) {
+		return errs.NewAppErr(err, "unsupported request body: "+reqErr.Reason, errs.ErrorCodeMediaType)
+	}
+
+	field, rule, reason := "", "invalid", reqErr.Reason
+	if errors.Is(reqErr.Err, openapi3filter.ErrInvalidRequired) {
+		rule = "required"
+	}
+	var schemaErr *openapi3.SchemaError
+	if errors.As(reqErr.Err, &schemaErr) {
+		field = strings.Join(schemaErr.JSONPointer(), ".")
+		rule = schemaErr.SchemaField
+		reason = schemaErr.Reason
+	}
+	if reason == "" && reqErr.Err != nil {
+		reason = reqErr.Err.Error()
+	}
+	if field != "" {
+		reason = fmt.Sprintf("%s: %s", field, reason)
+	}
+
+	var msg string
+	switch {
+	case reqErr.Parameter != nil:
+		msg = fmt.Sprintf("invalid %s parameter %q: %s", reqErr.Parameter.In, reqErr.Parameter.Name, reason)
+		field = reqErr.Parameter.Name
+	case reqErr.RequestBody != nil:
+		msg = "invalid request body: " + reason
+	default:
+		return errs.NewBadRequestErr(err, reason)
+	}
+	var details []errs.FieldError
+	if field != "" {
+		details = append(details, errs.FieldError{Field: field, Rule: rule})
+	}
+	return errs.NewValidationErr(err, msg, details)
+}
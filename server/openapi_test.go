@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/Av1shay/di-demo/cache/memory"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/types"
+	"github.com/Av1shay/di-demo/repositories/mock"
+	"github.com/Av1shay/di-demo/uam"
+	"github.com/go-chi/chi/v5"
+	"github.com/go-playground/validator/v10"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var pathParamRe = regexp.MustCompile(`\{[^}]+}`)
+
+func TestOpenAPI_InSyncWithRoutes(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, &mock.Repository{}, memory.NewCache())
+	require.NoError(t, err)
+	serv, err := New(ctx, validator.New(), &mockAuthenticator{}, uamAPI, WithRequestValidation(true), WithAdmin("admin-token", nil))
+	require.NoError(t, err)
+	serv.MountHandlers()
+
+	var routes []string
+	err = chi.Walk(serv.Router(), func(method, route string, _ http.Handler, _ ...func(http.Handler) http.Handler) error {
+		routes = append(routes, method+" "+pathParamRe.ReplaceAllString(route, "{}"))
+		return nil
+	})
+	require.NoError(t, err)
+
+	doc, err := loadOpenAPIDoc(ctx)
+	require.NoError(t, err)
+	var documented []string
+	for path, item := range doc.Paths.Map() {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+pathParamRe.ReplaceAllString(path, "{}"))
+		}
+	}
+
+	slices.Sort(routes)
+	slices.Sort(documented)
+	require.Equal(t, routes, documented)
+
+	var codes []string
+	for code := range errCodeToHttpCode {
+		codes = append(codes, string(code))
+	}
+	var documentedCodes []string
+	for _, code := range doc.Components.Schemas["ErrorCode"].Value.Enum {
+		documentedCodes = append(documentedCodes, code.(string))
+	}
+	slices.Sort(codes)
+	slices.Sort(documentedCodes)
+	require.Equal(t, codes, documentedCodes)
+}
+
+func TestOpenAPI_Validation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := buildItem()
+	mockRepo := &mock.Repository{SaveItemRes: item, ListItemsRes: []types.Item{item}}
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+	user := buildUser(item.AccountID)
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, &mockAuthenticator{user: user}, uamAPI, WithRequestValidation(true))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	t.Run("test_spec", func(t *testing.T) {
+		resp, err := ts.Client().Get(ts.URL + "/openapi.json")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		type operation struct {
+			OperationID string `json:"operationId"`
+			Deprecated  bool   `json:"deprecated"`
+		}
+		var doc struct {
+			OpenAPI string `json:"openapi"`
+			Paths   map[string]struct {
+				Get *operation `json:"get"`
+			} `json:"paths"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&doc))
+		require.Equal(t, "3.0.3", doc.OpenAPI)
+		// the root aliases are generated from the /v1 operations
+		require.Equal(t, &operation{OperationID: "getItemByName"}, doc.Paths["/v1/item/{item}"].Get)
+		require.Equal(t, &operation{OperationID: "getItemByNameDeprecated", Deprecated: true}, doc.Paths["/item/{item}"].Get)
+	})
+
+	for _, tt := range []struct {
+		name        string
+		method      string
+		path        string
+		body        string
+		contentType string
+		wantStatus  int
+		wantErr     string
+	}{
+		{
+			name:       "invalid_body_type",
+			method:     http.MethodPost,
+			path:       "/item",
+			body:       `{"name": 5}`,
+			wantStatus: http.StatusBadRequest,
+			wantErr:    "invalid request body: name",
+		},
+		{
+			name:       "invalid_query",
+			method:     http.MethodGet,
+			path:       "/items?sort=sideways",
+			wantStatus: http.StatusBadRequest,
+			wantErr:    `invalid query parameter "sort"`,
+		},
+		{
+			name:        "unsupported_content_type",
+			method:      http.MethodPost,
+			path:        "/item",
+			body:        `name=my-item`,
+			contentType: "application/x-www-form-urlencoded",
+			wantStatus:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:       "valid_body",
+			method:     http.MethodPost,
+			path:       "/item",
+			body:       `{"name": "my-item", "value": "val"}`,
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "valid_query",
+			method:     http.MethodGet,
+			path:       "/items?sort=asc&limit=5",
+			wantStatus: http.StatusOK,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(ctx, tt.method, ts.URL+tt.path, bytes.NewReader([]byte(tt.body)))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "BEARER "+user.Token)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			} else if tt.body != "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantErr != "" {
+				var resErr errorBody
+				require.NoError(t, json.NewDecoder(resp.Body).Decode(&resErr))
+				require.Equal(t, errs.ErrorCodeValidation, resErr.Code)
+				require.True(t, strings.HasPrefix(resErr.Message, tt.wantErr), resErr.Message)
+				require.Len(t, resErr.Details, 1)
+			}
+		})
+	}
+}
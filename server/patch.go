@@ -0,0 +1,158 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/types"
+	"mime"
+	"net/http"
+)
+
+const (
+	contentTypeMergePatch = "application/merge-patch+json"
+	contentTypeJSONPatch  = "application/json-patch+json"
+)
+
+// jsonPatchOp is an operation of an RFC 6902 JSON Patch document.
+type jsonPatchOp struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	Value json.RawMessage `json:"value"`
+}
+
+// isJSONPatch reports whether the body of r is a JSON Patch document, other bodies are merge patches.
+func isJSONPatch(r *http.Request) bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return mediaType == contentTypeJSONPatch
+}
+
+// applyMergePatch builds the patch of an item from an RFC 7396 merge patch document, null removes the value.
+func applyMergePatch(doc map[string]json.RawMessage) (types.PatchItemInput, error) {
+	if doc == nil {
+		return types.PatchItemInput{}, errs.NewBadRequestErr(nil, "Merge patch must be a JSON object")
+	}
+	var input types.PatchItemInput
+	for field, raw := range doc {
+		if err := setPatchField(&input, field, raw); err != nil {
+			return types.PatchItemInput{}, err
+		}
+	}
+	return input, nil
+}
+
+// applyJSONPatch builds the patch of an item from the operations of an RFC 6902 JSON Patch document. Tests of the version become the expected version of
+// the patch, tests of other fields are checked against current, which is loaded once, and make the patch expect its
+// version so the item can't change in between.
+func applyJSONPatch(ops []jsonPatchOp, current func() (types.Item, error)) (types.PatchItemInput, error) {
+	var (
+		input  types.PatchItemInput
+		loaded *types.Item
+	)
+	expectVersion := func(version int) error {
+		if input.ExpectedVersion > 0 && input.ExpectedVersion != version {
+			return errs.NewPreconditionFailedErr(nil, fmt.Sprintf("JSON Patch test failed: item is not at version %d", version))
+		}
+		input.ExpectedVersion = version
+		return nil
+	}
+
+	for i, op := range ops {
+		field, ok := patchPaths[op.Path]
+		if !ok {
+			return types.PatchItemInput{}, errs.NewBadRequestErr(nil, fmt.Sprintf("JSON Patch operation %d: unsupported path %q", i, op.Path))
+		}
+		switch op.Op {
+		case "add", "replace":
+			if err := setPatchField(&input, field, op.Value); err != nil {
+				return types.PatchItemInput{}, err
+			}
+		case "remove":
+			if err := setPatchField(&input, field, json.RawMessage("null")); err != nil {
+				return types.PatchItemInput{}, err
+			}
+		case "test":
+			if field == "version" {
+				var version int
+				if err := json.Unmarshal(op.Value, &version); err != nil {
+					return types.PatchItemInput{}, errs.NewBadRequestErr(err, fmt.Sprintf("JSON Patch operation %d: version must be an integer", i))
+				}
+				if err := expectVersion(version); err != nil {
+					return types.PatchItemInput{}, err
+				}
+				continue
+			}
+			var want string
+			if err := json.Unmarshal(op.Value, &want); err != nil {
+				return types.PatchItemInput{}, errs.NewBadRequestErr(err, fmt.Sprintf("JSON Patch operation %d: %s must be a string", i, field))
+			}
+			got := patchedField(input, field)
+			if got == nil {
+				if loaded == nil {
+					item, err := current()
+					if err != nil {
+						return types.PatchItemInput{}, err
+					}
+					if err := expectVersion(item.Version); err != nil {
+						return types.PatchItemInput{}, err
+					}
+					loaded = &item
+				}
+				got = itemField(loaded, field)
+			}
+			if *got != want {
+				return types.PatchItemInput{}, errs.NewPreconditionFailedErr(nil, fmt.Sprintf("JSON Patch test failed: %s is not %q", field, want))
+			}
+		default:
+			return types.PatchItemInput{}, errs.NewBadRequestErr(nil, fmt.Sprintf("JSON Patch operation %d: unsupported op %q", i, op.Op))
+		}
+	}
+	return input, nil
+}
+
+// patchPaths maps the JSON pointers a JSON Patch may refer to, to the item fields.
+var patchPaths = map[string]string{
+	"/name":    "name",
+	"/value":   "value",
+	"/version": "version",
+}
+
+func setPatchField(input *types.PatchItemInput, field string, raw json.RawMessage) error {
+	var v *string
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return errs.NewValidationErr(err, fmt.Sprintf("Validation failed: field '%s' must be a string", field),
+			[]errs.FieldError{{Field: field, Rule: "string"}})
+	}
+	switch field {
+	case "name":
+		if v == nil {
+			return errs.NewValidationErr(nil, "Validation failed: field 'name' failed on the 'required' rule",
+				[]errs.FieldError{{Field: field, Rule: "required"}})
+		}
+		input.Name = v
+	case "value":
+		if v == nil {
+			v = new(string)
+		}
+		input.Value = v
+	default:
+		return errs.NewValidationErr(nil, fmt.Sprintf("Validation failed: field '%s' can't be changed", field),
+			[]errs.FieldError{{Field: field, Rule: "readonly"}})
+	}
+	return nil
+}
+
+// patchedField returns the value set for field in input, nil when it is not changed.
+func patchedField(input types.PatchItemInput, field string) *string {
+	if field == "name" {
+		return input.Name
+	}
+	return input.Value
+}
+
+func itemField(item *types.Item, field string) *string {
+	if field == "name" {
+		return &item.Name
+	}
+	return &item.Value
+}
@@ -0,0 +1,67 @@
+package server
+
+import (
+	"fmt"
+	"github.com/Av1shay/di-demo/authentication"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Route groups sharing a rate limit.
+const (
+	RateLimitGroupPublic = "public"
+	RateLimitGroupRead   = "read"
+	RateLimitGroupWrite  = "write"
+)
+
+// RateLimitMiddleware limits the requests to the routes of group per account, or per client IP when the
+// request is not authenticated. Requests are let through when the limiter fails.
+func (s *Server) RateLimitMiddleware(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		limit, ok := s.rateLimits[group]
+		if s.rateLimiter == nil || !ok {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			res, err := s.rateLimiter.Allow(ctx, group+":"+rateLimitKey(r), limit)
+			if err != nil {
+				log.Errorf(ctx, "Rate limiter failed: %v", err)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+			w.Header().Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			w.Header().Set("RateLimit-Reset", strconv.Itoa(ceilSeconds(res.ResetAfter)))
+			if !res.Allowed {
+				retryAfter := max(ceilSeconds(res.RetryAfter), 1)
+				w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+				errorResponse(w, r, errs.NewRateLimitedErr(nil, fmt.Sprintf("Rate limit exceeded, retry in %d seconds", retryAfter)))
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the client of r, by its account when authenticated and by its IP otherwise.
+func rateLimitKey(r *http.Request) string {
+	if usr, err := authentication.UserFromContext(r.Context()); err == nil && usr.AccountID != "" {
+		return "account:" + usr.AccountID
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return "ip:" + host
+}
+
+func ceilSeconds(d time.Duration) int {
+	return int(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,77 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+// RecoverMiddleware turns panics of the handlers into internal errors, logged with their stack and the trace ID
+// of the request. Responses that already started can't be replaced, so their connection is aborted instead.
+func (s *Server) RecoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rw := &recoverRespWriter{ResponseWriter: w}
+		outerHeader := w.Header().Clone()
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				// handlers abort responses on purpose, the server closes the connection without logging
+				panic(rec)
+			}
+			s.panics.Add(1)
+			err := fmt.Errorf("panic: %v\n%s", rec, debug.Stack())
+			if rw.wroteHeader {
+				log.Errorf(r.Context(), "Server error after the response started: %v", err)
+				panic(http.ErrAbortHandler)
+			}
+			resetHeader(w.Header(), outerHeader)
+			errorResponse(rw, r, errs.NewInternalServerErr(err, "Something went wrong"))
+		}()
+		next.ServeHTTP(rw, r)
+	})
+}
+
+// resetHeader drops the headers the handler set for the response it did not write, like ETag or Content-Length, and
+// keeps the headers of the outer middlewares and the CORS headers, so browsers can read the error.
+func resetHeader(h, outer http.Header) {
+	for k := range h {
+		if v, ok := outer[k]; ok {
+			h[k] = v
+		} else if !strings.HasPrefix(k, "Access-Control-") && k != "Vary" {
+			delete(h, k)
+		}
+	}
+}
+
+// Panics returns the number of handler panics recovered since the server started.
+func (s *Server) Panics() uint64 {
+	return s.panics.Load()
+}
+
+// recoverRespWriter records whether the response started, after which an error response can't be written.
+type recoverRespWriter struct {
+	http.ResponseWriter
+	wroteHeader bool
+}
+
+func (rw *recoverRespWriter) WriteHeader(code int) {
+	rw.wroteHeader = true
+	rw.ResponseWriter.WriteHeader(code)
+}
+
+func (rw *recoverRespWriter) Write(b []byte) (int, error) {
+	rw.wroteHeader = true
+	return rw.ResponseWriter.Write(b)
+}
+
+// Unwrap lets http.ResponseController reach the Flush and deadline methods of the underlying writer.
+func (rw *recoverRespWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
@@ -5,13 +5,20 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"github.com/Av1shay/di-demo/events"
 	"github.com/Av1shay/di-demo/pkg/errs"
 	"github.com/Av1shay/di-demo/pkg/log"
 	"github.com/Av1shay/di-demo/pkg/types"
+	"github.com/Av1shay/di-demo/ratelimit"
 	"github.com/Av1shay/di-demo/uam"
+	"github.com/getkin/kin-openapi/routers"
 	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
+	"maps"
 	"net/http"
+	"reflect"
+	"strings"
+	"sync"
 	"sync/atomic"
 	"time"
 )
@@ -23,6 +30,13 @@ var errCodeToHttpCode = map[errs.ErrorCode]int{
 	errs.ErrorCodeValidation:   http.StatusBadRequest,
 	errs.ErrorCodeUnauthorized: http.StatusUnauthorized,
 	errs.ErrorCodeBadRequest:   http.StatusBadRequest,
+	errs.ErrorCodeRateLimited:  http.StatusTooManyRequests,
+	errs.ErrorCodePrecondition: http.StatusPreconditionFailed,
+	errs.ErrorCodeIdempotency:  http.StatusUnprocessableEntity,
+	errs.ErrorCodeTooLarge:     http.StatusRequestEntityTooLarge,
+	errs.ErrorCodeMediaType:    http.StatusUnsupportedMediaType,
+	errs.ErrorCodeNotAccepted:  http.StatusNotAcceptable,
+	errs.ErrorCodeTimeout:      http.StatusGatewayTimeout,
 }
 
 type Authenticator interface {
@@ -30,40 +44,153 @@ type Authenticator interface {
 }
 
 type Server struct {
-	router    *chi.Mux
-	validator *validator.Validate
-	auth      Authenticator
-	uamAPI    *uam.API
-	hcStatus  atomic.Bool
+	router           *chi.Mux
+	validator        *validator.Validate
+	auth             Authenticator
+	uamAPI           *uam.API
+	ready            atomic.Bool
+	shuttingDown     atomic.Bool
+	validateRequests bool
+	openAPIRouter    routers.Router
+	rateLimiter      ratelimit.Limiter
+	rateLimits       map[string]ratelimit.Limit
+	idempotencyStore uam.Cache
+	idempotencyTTL   time.Duration
+	idempotencyLocks keyedMutex
+	maxBodySize      int64
+	maxImportSize    int64
+	rootDeprecatedAt time.Time
+	rootSunset       time.Time
+	cors             *CORSOptions
+	broker           *events.Broker
+	shutdown         chan struct{}
+	shutdownOnce     sync.Once
+	healthChecks     []healthCheck
+	healthInterval   time.Duration
+	healthTimeout    time.Duration
+	healthMu         sync.RWMutex
+	healthResults    map[string]checkResult
+	adminToken       string
+	adminConfigView  func() map[string]any
+	adminFailures    *authFailureLimiter
+	routeTimeouts    map[string]time.Duration
+	panics           atomic.Uint64
+	accessLog        AccessLogOptions
 }
 
-func New(ctx context.Context, validator *validator.Validate, auth Authenticator, uamAPI *uam.API) (*Server, error) {
+type Option func(s *Server)
+
+// WithRequestValidation makes the server reject requests that do not match its OpenAPI document.
+func WithRequestValidation(enabled bool) Option {
+	return func(s *Server) {
+		s.validateRequests = enabled
+	}
+}
+
+// WithRateLimiter limits the requests of every route group to its limit in limits, groups without a limit are not limited.
+func WithRateLimiter(limiter ratelimit.Limiter, limits map[string]ratelimit.Limit) Option {
+	return func(s *Server) {
+		s.rateLimiter = limiter
+		s.rateLimits = limits
+	}
+}
+
+func New(ctx context.Context, validator *validator.Validate, auth Authenticator, uamAPI *uam.API, opts ...Option) (*Server, error) {
 	s := &Server{
-		validator: validator,
-		auth:      auth,
-		uamAPI:    uamAPI,
+		validator:        validator,
+		auth:             auth,
+		uamAPI:           uamAPI,
+		maxBodySize:      defaultMaxBodySize,
+		maxImportSize:    defaultMaxImportSize,
+		shutdown:         make(chan struct{}),
+		rootDeprecatedAt: defaultRootDeprecatedAt,
+		healthInterval:   defaultHealthCheckInterval,
+		healthTimeout:    defaultHealthCheckTimeout,
+		healthResults:    make(map[string]checkResult),
+		routeTimeouts:    maps.Clone(defaultRouteTimeouts),
+		adminFailures:    newAuthFailureLimiter(),
+	}
+	s.healthChecks = []healthCheck{
+		{name: "repository", critical: true, check: uamAPI.HealthCheck},
+		{name: "cache", critical: false, check: uamAPI.CacheHealthCheck},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	if s.rootSunset.IsZero() {
+		s.rootSunset = s.rootDeprecatedAt.AddDate(0, 6, 0)
 	}
 	if err := s.registerValidators(); err != nil {
 		return nil, fmt.Errorf("failed to register validators: %w", err)
 	}
-	go s.startHealthCheck(ctx, time.Second)
+	if s.validateRequests {
+		openAPIRouter, err := newOpenAPIRouter(ctx)
+		if err != nil {
+			return nil, err
+		}
+		s.openAPIRouter = openAPIRouter
+	}
+	s.ready.Store(true)
+	go s.startHealthCheck(ctx)
 	return s, nil
 }
 
 func (s *Server) MountHandlers() {
 	s.router = chi.NewRouter()
 	s.router.Use(TraceIDMiddleware)
-	s.router.Use(LogMiddleware)
+	s.router.Use(s.LogMiddleware)
+	s.router.Use(s.RecoverMiddleware)
+	s.router.Use(s.CORSMiddleware)
+	s.router.Use(CompressMiddleware)
+	s.router.Use(s.BodyLimitMiddleware)
 
 	s.router.Get("/health-check", s.HealthCheckHandler)
+	s.router.Get("/livez", s.LivenessHandler)
+	s.router.Get("/readyz", s.ReadinessHandler)
+	s.router.With(s.RateLimitMiddleware(RateLimitGroupPublic)).Get("/openapi.json", s.OpenAPIHandler)
+	if s.adminToken != "" {
+		s.router.Route("/admin", s.mountAdminRoutes)
+	}
 
+	s.router.Route("/"+apiV1.name, func(r chi.Router) {
+		s.mountItemRoutes(r, apiV1)
+	})
+	// deprecated aliases of the v1 routes
 	s.router.Group(func(r chi.Router) {
+		r.Use(s.DeprecationMiddleware(apiV1))
+		s.mountItemRoutes(r, apiV1)
+	})
+}
+
+func (s *Server) mountItemRoutes(r chi.Router, v apiVersion) {
+	r.Group(func(r chi.Router) {
+		r.Use(apiVersionMiddleware(v))
 		r.Use(s.AuthMiddleware)
-		r.Get("/item/{name}", s.GetItemByNameHandler)
-		r.Post("/item", s.AddItemHandler)
-		r.Put("/item/{id}", s.UpdateItemHandler)
-		r.Get("/items", s.ListItemsHandler)
-		r.Delete("/item/{id}", s.DeleteItemHandler)
+		if s.validateRequests {
+			r.Use(s.OpenAPIValidationMiddleware)
+		}
+		r.Group(func(r chi.Router) {
+			r.Use(s.RateLimitMiddleware(RateLimitGroupRead))
+			r.Group(func(r chi.Router) {
+				r.Use(s.TimeoutMiddleware(RouteGroupRead))
+				r.Get("/item/{name}", s.GetItemByNameHandler)
+				r.Get("/items", s.ListItemsHandler)
+			})
+			// streams last as long as the client keeps reading, every write has a deadline instead
+			r.Get("/items/export", s.ExportItemsHandler)
+			r.Get("/items/watch", s.WatchItemsHandler)
+		})
+		r.Group(func(r chi.Router) {
+			r.Use(s.RateLimitMiddleware(RateLimitGroupWrite))
+			r.Use(s.TimeoutMiddleware(RouteGroupWrite))
+			r.Use(s.IdempotencyMiddleware)
+			r.Post("/item", s.AddItemHandler)
+			r.Put("/item/{id}", s.UpdateItemHandler)
+			r.Patch("/item/{id}", s.PatchItemHandler)
+			r.Delete("/item/{id}", s.DeleteItemHandler)
+		})
+		// imports are streamed, so their bodies are not kept for idempotent replays
+		r.With(s.RateLimitMiddleware(RateLimitGroupWrite), s.TimeoutMiddleware(RouteGroupImport)).Post(importPath, s.ImportItemsHandler)
 	})
 }
 
@@ -78,38 +205,27 @@ func (s *Server) registerValidators() error {
 	if err := s.validator.RegisterValidation("is_valid_orderby", types.IsValidOrderBy); err != nil {
 		return err
 	}
+	// report fields by their json names
+	s.validator.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
 	return nil
 }
 
-func (s *Server) startHealthCheck(ctx context.Context, interval time.Duration) {
-	ticker := time.NewTicker(interval)
-	defer ticker.Stop()
-
-	for {
-		select {
-		case <-ticker.C:
-			func() {
-				ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
-				defer cancel()
-				if err := s.uamAPI.HealthCheck(ctx); err != nil {
-					log.Errorf(ctx, "Health check failed: %v", err)
-					s.hcStatus.Store(false)
-					return
-				}
-				s.hcStatus.Store(true)
-			}()
-		case <-ctx.Done():
-			return
-		}
-	}
+// SetReady marks the server as ready to take traffic, the health check fails while it is not ready.
+func (s *Server) SetReady(v bool) {
+	s.ready.Store(v)
 }
 
-func (s *Server) HealthCheckHandler(w http.ResponseWriter, r *http.Request) {
-	if s.hcStatus.Load() {
-		w.WriteHeader(http.StatusOK)
-		return
-	}
-	w.WriteHeader(http.StatusServiceUnavailable)
+// StartShutdown marks the server as shutting down, the health check fails from now on and event streams are closed
+// so they do not hold up draining the other requests.
+func (s *Server) StartShutdown() {
+	s.shuttingDown.Store(true)
+	s.shutdownOnce.Do(func() { close(s.shutdown) })
 }
 
 func successResponse(ctx context.Context, w http.ResponseWriter, code int, val any) {
@@ -121,33 +237,99 @@ func successResponse(ctx context.Context, w http.ResponseWriter, code int, val a
 	}
 }
 
-func errorResponse(ctx context.Context, w http.ResponseWriter, err error) {
-	w.Header().Set("Content-Type", "application/json")
+type errorBody struct {
+	Code      errs.ErrorCode    `json:"code"`
+	Message   string            `json:"message"`
+	TraceID   string            `json:"trace_id,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Details   []errs.FieldError `json:"details,omitempty"`
+}
 
-	code, msg, err := parseErr(err)
+// problemBody is an RFC 7807 problem details document extended with the errorBody fields.
+type problemBody struct {
+	Type     string `json:"type"`
+	Title    string `json:"title"`
+	Status   int    `json:"status"`
+	Detail   string `json:"detail"`
+	Instance string `json:"instance,omitempty"`
+	errorBody
+}
+
+func errorResponse(w http.ResponseWriter, r *http.Request, err error) {
+	ctx := r.Context()
+
+	status, appErr, err := parseErr(err)
 
-	if code == http.StatusInternalServerError {
+	switch status {
+	case http.StatusInternalServerError:
 		log.Errorf(ctx, "Server error: %v", err)
+	case http.StatusGatewayTimeout:
+		log.Errorf(ctx, "Request timed out: %v", err)
 	}
 
-	w.WriteHeader(code)
-	_ = json.NewEncoder(w).Encode(map[string]string{"error": msg})
+	body := errorBody{
+		Code:      appErr.Code,
+		Message:   appErr.Msg,
+		TraceID:   log.TraceIDFromContext(ctx),
+		RequestID: log.RequestIDFromContext(ctx),
+		Details:   appErr.Details,
+	}
+
+	if strings.Contains(r.Header.Get("Accept"), "application/problem+json") {
+		w.Header().Set("Content-Type", "application/problem+json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(problemBody{
+			Type:      "about:blank",
+			Title:     http.StatusText(status),
+			Status:    status,
+			Detail:    appErr.Msg,
+			Instance:  r.URL.Path,
+			errorBody: body,
+		})
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(body)
 }
 
-func parseErr(err error) (int, string, error) {
-	code := http.StatusInternalServerError
-	msg := "Something went wrong"
+// parseErr returns the http status and the application error to report to the client
+// together with the underlying error. Errors of requests that ran out of time are timeouts, unless they have a
+// more specific code.
+func parseErr(err error) (int, *errs.AppError, error) {
+	status := http.StatusInternalServerError
+	res := &errs.AppError{Code: errs.ErrorCodeInternal, Msg: "Something went wrong"}
 	var apiErr *errs.AppError
-	if errors.As(err, &apiErr) {
+	isAppErr := errors.As(err, &apiErr)
+	if errors.Is(err, context.DeadlineExceeded) && (!isAppErr || apiErr.Code == errs.ErrorCodeInternal) {
+		apiErr = errs.NewTimeoutErr(err, "The request did not complete in time")
+	}
+	if apiErr != nil {
 		if c, ok := errCodeToHttpCode[apiErr.Code]; ok {
-			code = c
+			status = c
 		}
-		msg = apiErr.Msg
-		if msg == "" && apiErr.Err != nil {
-			msg = apiErr.Err.Error()
+		res = &errs.AppError{Code: apiErr.Code, Msg: apiErr.Msg, Details: apiErr.Details}
+		if res.Msg == "" && apiErr.Err != nil {
+			res.Msg = apiErr.Err.Error()
 		}
 		err = apiErr.Err
 	}
 
-	return code, msg, err
+	return status, res, err
+}
+
+// validationErr converts validator errors to a validation error with the details of every invalid field.
+func validationErr(err error) *errs.AppError {
+	var vErrs validator.ValidationErrors
+	if !errors.As(err, &vErrs) {
+		return errs.NewBadRequestErr(err, "")
+	}
+	details := make([]errs.FieldError, 0, len(vErrs))
+	msgs := make([]string, 0, len(vErrs))
+	for _, fe := range vErrs {
+		details = append(details, errs.FieldError{Field: fe.Field(), Rule: fe.Tag()})
+		msgs = append(msgs, fmt.Sprintf("field '%s' failed on the '%s' rule", fe.Field(), fe.Tag()))
+	}
+	return errs.NewValidationErr(err, "Validation failed: "+strings.Join(msgs, ", "), details)
 }
@@ -1,27 +1,39 @@
 package server
 
 import (
+	"bufio"
 	"bytes"
 	"cmp"
+	"compress/gzip"
 	"context"
+	"encoding/csv"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"github.com/Av1shay/di-demo/authentication"
 	"github.com/Av1shay/di-demo/cache/memory"
+	"github.com/Av1shay/di-demo/events"
 	"github.com/Av1shay/di-demo/pkg/errs"
 	"github.com/Av1shay/di-demo/pkg/types"
+	"github.com/Av1shay/di-demo/ratelimit"
+	ratelimitmemory "github.com/Av1shay/di-demo/ratelimit/memory"
 	"github.com/Av1shay/di-demo/repositories/mock"
 	"github.com/Av1shay/di-demo/uam"
 	"github.com/brianvoe/gofakeit/v7"
+	"github.com/go-chi/chi/v5"
 	"github.com/go-playground/validator/v10"
+	"github.com/klauspost/compress/zstd"
 	"github.com/stretchr/testify/require"
 	"io"
+	"log/slog"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"slices"
 	"strconv"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 )
@@ -75,6 +87,28 @@ func TestServer_GetItem(t *testing.T) {
 		require.Contains(t, string(b), "not found")
 	})
 
+	t.Run("test_problem_details", func(t *testing.T) {
+		mockRepo.ReturnErr = errs.NewNotFoundErr(errors.New("not found"), "item 'not-exist' not found")
+		t.Cleanup(func() { mockRepo.ReturnErr = nil })
+		req, err := http.NewRequestWithContext(ctx, "GET", ts.URL+"/item/not-exist", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Accept", "application/problem+json")
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusNotFound, resp.StatusCode)
+		require.Equal(t, "application/problem+json", resp.Header.Get("Content-Type"))
+		var problem problemBody
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&problem))
+		require.Equal(t, http.StatusNotFound, problem.Status)
+		require.Equal(t, "Not Found", problem.Title)
+		require.Equal(t, "item 'not-exist' not found", problem.Detail)
+		require.Equal(t, "/item/not-exist", problem.Instance)
+		require.Equal(t, errs.ErrorCodeNotFound, problem.Code)
+		require.NotEmpty(t, problem.TraceID)
+	})
+
 	t.Run("test_ok", func(t *testing.T) {
 		createdItem, err := uamAPI.CreateItem(ctx, types.ItemCreateInput{}, user.AccountID)
 		require.NoError(t, err)
@@ -129,17 +163,18 @@ func TestServer_AddItem(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, "POST", ts.URL+"/item", bytes.NewReader(b))
 		require.NoError(t, err)
 		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Content-Type", "application/json")
 		resp, err := ts.Client().Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
 		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
-		var resErr struct {
-			Error string `json:"error"`
-		}
+		var resErr errorBody
 		err = json.NewDecoder(resp.Body).Decode(&resErr)
 		require.NoError(t, err)
-		require.NotEmpty(t, resErr.Error)
-		require.Contains(t, strings.ToLower(resErr.Error), "field validation for 'name' failed")
+		require.NotEmpty(t, resErr.Message)
+		require.Equal(t, errs.ErrorCodeValidation, resErr.Code)
+		require.Contains(t, resErr.Message, "field 'name' failed on the 'required' rule")
+		require.Equal(t, []errs.FieldError{{Field: "name", Rule: "required"}}, resErr.Details)
 	})
 
 	t.Run("test_ok", func(t *testing.T) {
@@ -150,6 +185,7 @@ func TestServer_AddItem(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, "POST", ts.URL+"/item", bytes.NewReader(b))
 		require.NoError(t, err)
 		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Content-Type", "application/json")
 		resp, err := ts.Client().Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
@@ -168,6 +204,117 @@ func TestServer_AddItem(t *testing.T) {
 	})
 }
 
+func TestServer_StrictDecoding(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := buildItem()
+	mockRepo := &mock.Repository{SaveItemRes: item}
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(item.AccountID)
+	mockAuth := &mockAuthenticator{user: user}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, mockAuth, uamAPI, WithMaxBodySize(64))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantCode    errs.ErrorCode
+		wantMsg     string
+	}{
+		{
+			name:        "ok",
+			contentType: "application/json; charset=utf-8",
+			body:        `{"name": "my-item"}`,
+			wantStatus:  http.StatusCreated,
+		},
+		{
+			name:       "no_content_type",
+			body:       `{"name": "my-item"}`,
+			wantStatus: http.StatusUnsupportedMediaType,
+			wantCode:   errs.ErrorCodeMediaType,
+			wantMsg:    "Content-Type must be application/json",
+		},
+		{
+			name:        "too_large",
+			contentType: "application/json",
+			body:        `{"name": "` + strings.Repeat("a", 64) + `"}`,
+			wantStatus:  http.StatusRequestEntityTooLarge,
+			wantCode:    errs.ErrorCodeTooLarge,
+			wantMsg:     "Request body must not be larger than 64 bytes",
+		},
+		{
+			name:        "unknown_field",
+			contentType: "application/json",
+			body:        `{"name": "my-item", "color": "red"}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    errs.ErrorCodeBadRequest,
+			wantMsg:     `Request body contains unknown field "color"`,
+		},
+		{
+			name:        "trailing_data",
+			contentType: "application/json",
+			body:        `{"name": "my-item"} {}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    errs.ErrorCodeBadRequest,
+			wantMsg:     "Request body must only contain a single JSON value",
+		},
+		{
+			name:        "invalid_type",
+			contentType: "application/json",
+			body:        `{"name": 5}`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    errs.ErrorCodeBadRequest,
+			wantMsg:     `Request body contains an invalid value for the "name" field (at position 10)`,
+		},
+		{
+			name:        "malformed",
+			contentType: "application/json",
+			body:        `{"name": }`,
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    errs.ErrorCodeBadRequest,
+			wantMsg:     "Request body contains badly-formed JSON (at position 10)",
+		},
+		{
+			name:        "empty",
+			contentType: "application/json",
+			wantStatus:  http.StatusBadRequest,
+			wantCode:    errs.ErrorCodeBadRequest,
+			wantMsg:     "Request body must not be empty",
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequestWithContext(ctx, "POST", ts.URL+"/item", strings.NewReader(tt.body))
+			require.NoError(t, err)
+			req.Header.Set("Authorization", "BEARER "+user.Token)
+			if tt.contentType != "" {
+				req.Header.Set("Content-Type", tt.contentType)
+			}
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantCode == "" {
+				return
+			}
+			var resErr errorBody
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&resErr))
+			require.Equal(t, tt.wantCode, resErr.Code)
+			require.Equal(t, tt.wantMsg, resErr.Message)
+		})
+	}
+}
+
 func TestServer_UpdateItem(t *testing.T) {
 	t.Parallel()
 
@@ -201,17 +348,16 @@ func TestServer_UpdateItem(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, "PUT", ts.URL+"/item/-1", bytes.NewReader(b))
 		require.NoError(t, err)
 		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Content-Type", "application/json")
 		resp, err := ts.Client().Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
 		require.Equal(t, http.StatusNotFound, resp.StatusCode)
-		var resErr struct {
-			Error string `json:"error"`
-		}
+		var resErr errorBody
 		err = json.NewDecoder(resp.Body).Decode(&resErr)
 		require.NoError(t, err)
-		require.NotEmpty(t, resErr.Error)
-		require.Equal(t, strings.ToLower(resErr.Error), "not found")
+		require.NotEmpty(t, resErr.Message)
+		require.Equal(t, strings.ToLower(resErr.Message), "not found")
 	})
 
 	t.Run("test_ok", func(t *testing.T) {
@@ -221,6 +367,7 @@ func TestServer_UpdateItem(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, "PUT", ts.URL+"/item/"+item.ID, bytes.NewReader(b))
 		require.NoError(t, err)
 		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Content-Type", "application/json")
 		resp, err := ts.Client().Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
@@ -235,6 +382,115 @@ func TestServer_UpdateItem(t *testing.T) {
 	})
 }
 
+func TestServer_PatchItem(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := buildItem()
+	item.Version = 2
+	mockRepo := &mock.Repository{
+		GetItemRes:   item,
+		PatchItemRes: item,
+	}
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(item.AccountID)
+	mockAuth := &mockAuthenticator{user: user}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, mockAuth, uamAPI, WithRequestValidation(true))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	patch := func(contentType, body string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, "PATCH", ts.URL+"/item/"+item.ID, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Content-Type", contentType)
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	ptr := func(s string) *string { return &s }
+
+	for _, tt := range []struct {
+		name        string
+		contentType string
+		body        string
+		wantStatus  int
+		wantInput   types.PatchItemInput
+	}{
+		{
+			name:        "merge_patch_value",
+			contentType: contentTypeMergePatch,
+			body:        `{"value": "new value"}`,
+			wantStatus:  http.StatusOK,
+			wantInput:   types.PatchItemInput{ID: item.ID, Value: ptr("new value")},
+		},
+		{
+			name:        "merge_patch_remove_value",
+			contentType: contentTypeMergePatch,
+			body:        `{"name": "new-name", "value": null}`,
+			wantStatus:  http.StatusOK,
+			wantInput:   types.PatchItemInput{ID: item.ID, Name: ptr("new-name"), Value: ptr("")},
+		},
+		{
+			name:        "merge_patch_remove_name",
+			contentType: contentTypeMergePatch,
+			body:        `{"name": null}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "merge_patch_readonly",
+			contentType: contentTypeMergePatch,
+			body:        `{"version": 5}`,
+			wantStatus:  http.StatusBadRequest,
+		},
+		{
+			name:        "json_patch",
+			contentType: contentTypeJSONPatch,
+			body:        `[{"op": "test", "path": "/version", "value": 2}, {"op": "replace", "path": "/value", "value": "v"}]`,
+			wantStatus:  http.StatusOK,
+			wantInput:   types.PatchItemInput{ID: item.ID, Value: ptr("v"), ExpectedVersion: 2},
+		},
+		{
+			name:        "json_patch_test_field",
+			contentType: contentTypeJSONPatch,
+			body:        `[{"op": "test", "path": "/name", "value": "` + item.Name + `"}, {"op": "remove", "path": "/value"}]`,
+			wantStatus:  http.StatusOK,
+			wantInput:   types.PatchItemInput{ID: item.ID, Value: ptr(""), ExpectedVersion: item.Version},
+		},
+		{
+			name:        "json_patch_test_failed",
+			contentType: contentTypeJSONPatch,
+			body:        `[{"op": "test", "path": "/value", "value": "other"}, {"op": "replace", "path": "/value", "value": "v"}]`,
+			wantStatus:  http.StatusPreconditionFailed,
+		},
+		{
+			name:        "json_patch_unsupported_op",
+			contentType: contentTypeJSONPatch,
+			body:        `[{"op": "move", "path": "/value", "from": "/name"}]`,
+			wantStatus:  http.StatusBadRequest,
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			mockRepo.PatchItemIn = types.PatchItemInput{}
+			resp := patch(tt.contentType, tt.body)
+			require.Equal(t, tt.wantStatus, resp.StatusCode)
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+			require.Equal(t, tt.wantInput, mockRepo.PatchItemIn)
+			require.Equal(t, itemETag(item), resp.Header.Get("ETag"))
+		})
+	}
+}
+
 func TestServer_ListItems(t *testing.T) {
 	t.Parallel()
 
@@ -266,13 +522,13 @@ func TestServer_ListItems(t *testing.T) {
 		require.NoError(t, err)
 		defer resp.Body.Close()
 		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
-		var resErr struct {
-			Error string `json:"error"`
-		}
+		var resErr errorBody
 		err = json.NewDecoder(resp.Body).Decode(&resErr)
 		require.NoError(t, err)
-		require.NotEmpty(t, resErr.Error)
-		require.Contains(t, strings.ToLower(resErr.Error), "field validation for 'sort' failed on the 'is_valid_sort'")
+		require.NotEmpty(t, resErr.Message)
+		require.Equal(t, errs.ErrorCodeValidation, resErr.Code)
+		require.Contains(t, resErr.Message, "field 'sort' failed on the 'is_valid_sort' rule")
+		require.Equal(t, []errs.FieldError{{Field: "sort", Rule: "is_valid_sort"}}, resErr.Details)
 	})
 
 	t.Run("test_ok", func(t *testing.T) {
@@ -300,6 +556,360 @@ func TestServer_ListItems(t *testing.T) {
 	})
 }
 
+func TestServer_ExportItems(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	items := make([]types.Item, 150)
+	for i := range items {
+		items[i] = buildItem()
+	}
+	mockRepo := &mock.Repository{ListItemsRes: items}
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(items[0].AccountID)
+	mockAuth := &mockAuthenticator{user: user}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, mockAuth, uamAPI, WithRequestValidation(true))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	doReq := func(accept string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, "GET", ts.URL+"/v1/items/export", nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Accept", accept)
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	t.Run("test_ndjson", func(t *testing.T) {
+		resp := doReq("")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "application/x-ndjson", resp.Header.Get("Content-Type"))
+		dec := json.NewDecoder(resp.Body)
+		var gotItems []types.Item
+		for dec.More() {
+			var item types.Item
+			require.NoError(t, dec.Decode(&item))
+			gotItems = append(gotItems, item)
+		}
+		require.Len(t, gotItems, len(items))
+		require.Equal(t, items[0].ID, gotItems[0].ID)
+		require.Equal(t, items[len(items)-1].ID, gotItems[len(items)-1].ID)
+	})
+
+	t.Run("test_csv", func(t *testing.T) {
+		resp := doReq("application/json;q=0.5, text/csv")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/csv", resp.Header.Get("Content-Type"))
+		require.Contains(t, resp.Header.Get("Content-Disposition"), "items.csv")
+		records, err := csv.NewReader(resp.Body).ReadAll()
+		require.NoError(t, err)
+		require.Len(t, records, len(items)+1)
+		require.Equal(t, []string{"id", "name", "value", "version", "created_at", "updated_at"}, records[0])
+		require.Equal(t, items[0].ID, records[1][0])
+		require.Equal(t, items[0].Name, records[1][1])
+		require.Equal(t, items[0].Value, records[1][2])
+	})
+
+	t.Run("test_not_acceptable", func(t *testing.T) {
+		resp := doReq("application/xml")
+		require.Equal(t, http.StatusNotAcceptable, resp.StatusCode)
+		var body errorBody
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Equal(t, errs.ErrorCodeNotAccepted, body.Code)
+	})
+}
+
+func TestServer_ImportItems(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	existing := buildItem()
+	user := buildUser(existing.AccountID)
+
+	newServer := func(t *testing.T, opts ...Option) (*httptest.Server, *mock.Repository) {
+		mockRepo := &mock.Repository{
+			GetItemByNameRes: existing,
+			SaveItemErrs: map[string]error{
+				existing.Name: &errs.AppError{Code: errs.ErrorCodeDuplicate, Msg: "item already exist"},
+			},
+		}
+		uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+		require.NoError(t, err)
+		v := validator.New(validator.WithRequiredStructEnabled())
+		serv, err := New(ctx, v, &mockAuthenticator{user: user}, uamAPI, opts...)
+		require.NoError(t, err)
+		serv.MountHandlers()
+		ts := httptest.NewServer(serv.Router())
+		t.Cleanup(ts.Close)
+		return ts, mockRepo
+	}
+	doReq := func(t *testing.T, ts *httptest.Server, policy, contentType, body string) (*http.Response, types.ImportSummary) {
+		req, err := http.NewRequestWithContext(ctx, "POST", ts.URL+"/v1/items/import?on_conflict="+policy, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Content-Type", contentType)
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		var sum types.ImportSummary
+		if resp.StatusCode != http.StatusBadRequest && resp.StatusCode != http.StatusUnsupportedMediaType {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&sum))
+		}
+		return resp, sum
+	}
+
+	ndjson := strings.Join([]string{
+		`{"name": "first", "value": "1"}`,
+		``,
+		`{"name": "` + existing.Name + `", "value": "new value", "id": "ignored"}`,
+		`not json`,
+		`{"name": ""}`,
+		`{"name": "last"}`,
+	}, "\n")
+
+	t.Run("test_skip", func(t *testing.T) {
+		ts, mockRepo := newServer(t)
+		resp, sum := doReq(t, ts, "skip", "application/x-ndjson", ndjson)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, 2, sum.Created)
+		require.Equal(t, 1, sum.Skipped)
+		require.Equal(t, 2, sum.Failed)
+		require.False(t, sum.Aborted)
+		require.Equal(t, []int{3, 4, 5}, rowLines(sum.Rows))
+		require.Equal(t, types.ImportRowSkipped, sum.Rows[0].Status)
+		require.Equal(t, types.ImportRowFailed, sum.Rows[1].Status)
+		require.Contains(t, sum.Rows[2].Error, "'required'")
+		require.Equal(t, "last", mockRepo.SaveItemIn.Name)
+		require.Empty(t, mockRepo.UpdateItemIn.ID)
+	})
+
+	t.Run("test_overwrite", func(t *testing.T) {
+		ts, mockRepo := newServer(t)
+		resp, sum := doReq(t, ts, "overwrite", "application/x-ndjson", ndjson)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, 2, sum.Created)
+		require.Equal(t, 1, sum.Updated)
+		require.Equal(t, types.ImportRowResult{Line: 3, Name: existing.Name, Status: types.ImportRowUpdated}, sum.Rows[0])
+		require.Equal(t, types.UpdateItemInput{
+			ID:              existing.ID,
+			Name:            existing.Name,
+			Value:           "new value",
+			ExpectedVersion: existing.Version,
+		}, mockRepo.UpdateItemIn)
+	})
+
+	t.Run("test_fail", func(t *testing.T) {
+		ts, mockRepo := newServer(t)
+		resp, sum := doReq(t, ts, "", "application/x-ndjson", ndjson)
+		require.Equal(t, http.StatusConflict, resp.StatusCode)
+		require.True(t, sum.Aborted)
+		require.Equal(t, 1, sum.Created)
+		require.Equal(t, 1, sum.Failed)
+		require.Equal(t, []int{3}, rowLines(sum.Rows))
+		// the rows after the conflict are not imported
+		require.Equal(t, existing.Name, mockRepo.SaveItemIn.Name)
+	})
+
+	t.Run("test_csv", func(t *testing.T) {
+		// streamed bodies are validated by the handler
+		ts, mockRepo := newServer(t, WithRequestValidation(true))
+		body := "id,name,value\n" +
+			"1,first,\"a, b\"\n" +
+			"2,second\n" +
+			"3," + existing.Name + ",x\n" +
+			"4,last,z\n"
+		resp, sum := doReq(t, ts, "skip", "text/csv; charset=utf-8", body)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, 2, sum.Created)
+		require.Equal(t, 1, sum.Skipped)
+		require.Equal(t, 1, sum.Failed)
+		require.Equal(t, []int{3, 4}, rowLines(sum.Rows))
+		require.Equal(t, types.ItemCreateInput{Name: "last", Value: "z"}, mockRepo.SaveItemIn)
+	})
+
+	t.Run("test_too_large", func(t *testing.T) {
+		ts, _ := newServer(t, WithMaxImportSize(40))
+		resp, sum := doReq(t, ts, "skip", "application/x-ndjson", ndjson)
+		require.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+		require.True(t, sum.Aborted)
+		require.Equal(t, 1, sum.Created)
+		require.Equal(t, types.ImportRowFailed, sum.Rows[len(sum.Rows)-1].Status)
+	})
+
+	t.Run("test_slow_upload", func(t *testing.T) {
+		uamAPI, err := uam.NewAPI(uam.Config{}, &mock.Repository{}, memory.NewCache())
+		require.NoError(t, err)
+		v := validator.New(validator.WithRequiredStructEnabled())
+		serv, err := New(ctx, v, &mockAuthenticator{user: user}, uamAPI)
+		require.NoError(t, err)
+		serv.MountHandlers()
+		// the upload takes longer than the server timeouts, which are extended for every chunk
+		ts := httptest.NewUnstartedServer(serv.Router())
+		ts.Config.ReadTimeout = 200 * time.Millisecond
+		ts.Config.WriteTimeout = 200 * time.Millisecond
+		ts.Start()
+		t.Cleanup(ts.Close)
+
+		body, bodyWriter := io.Pipe()
+		go func() {
+			for chunk := range 3 {
+				time.Sleep(150 * time.Millisecond)
+				for i := range importChunkSize {
+					_, _ = fmt.Fprintf(bodyWriter, `{"name": "item-%d-%d"}`+"\n", chunk, i)
+				}
+			}
+			_ = bodyWriter.Close()
+		}()
+		req, err := http.NewRequestWithContext(ctx, "POST", ts.URL+"/v1/items/import", body)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Content-Type", "application/x-ndjson")
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		var sum types.ImportSummary
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&sum))
+		require.Equal(t, 3*importChunkSize, sum.Created)
+		require.False(t, sum.Aborted)
+	})
+
+	t.Run("test_bad_request", func(t *testing.T) {
+		ts, _ := newServer(t)
+		resp, _ := doReq(t, ts, "replace", "application/x-ndjson", ndjson)
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+		resp, _ = doReq(t, ts, "skip", "application/json", ndjson)
+		require.Equal(t, http.StatusUnsupportedMediaType, resp.StatusCode)
+		resp, _ = doReq(t, ts, "skip", "text/csv", "id,value\n1,a\n")
+		require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+}
+
+func rowLines(rows []types.ImportRowResult) []int {
+	lines := make([]int, len(rows))
+	for i, row := range rows {
+		lines[i] = row.Line
+	}
+	return lines
+}
+
+func TestServer_WatchItems(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := buildItem()
+	mockRepo := &mock.Repository{SaveItemRes: item}
+	broker := events.NewBroker()
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache(), uam.WithEventPublisher(broker))
+	require.NoError(t, err)
+
+	user := buildUser(item.AccountID)
+	mockAuth := &mockAuthenticator{user: user}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, mockAuth, uamAPI, WithEventBroker(broker))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	doReq := func(method, path, body string, headers map[string]string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+	// readEvent reads the fields of the next event in the stream
+	readEvent := func(r *bufio.Reader) map[string]string {
+		fields := make(map[string]string)
+		for {
+			line, err := r.ReadString('\n')
+			require.NoError(t, err)
+			line = strings.TrimSuffix(line, "\n")
+			if line == "" {
+				return fields
+			}
+			k, v, _ := strings.Cut(line, ": ")
+			fields[k] = v
+		}
+	}
+	watch := func(lastEventID string) (*http.Response, *bufio.Reader) {
+		headers := map[string]string{}
+		if lastEventID != "" {
+			headers["Last-Event-ID"] = lastEventID
+		}
+		resp := doReq("GET", "/v1/items/watch", "", headers)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "text/event-stream", resp.Header.Get("Content-Type"))
+		r := bufio.NewReader(resp.Body)
+		require.Equal(t, map[string]string{"retry": "3000"}, readEvent(r))
+		return resp, r
+	}
+
+	resp, stream := watch("")
+
+	resp2 := doReq("POST", "/v1/item", `{"name": "`+item.Name+`"}`, map[string]string{"Content-Type": "application/json"})
+	require.Equal(t, http.StatusCreated, resp2.StatusCode)
+	ev := readEvent(stream)
+	firstID := ev["id"]
+	require.Regexp(t, `^[0-9a-f]+-1$`, firstID)
+	require.Equal(t, "item.created", ev["event"])
+	var created events.Event
+	require.NoError(t, json.Unmarshal([]byte(ev["data"]), &created))
+	require.Equal(t, item.ID, created.ItemID)
+	require.Equal(t, item.Name, created.Item.Name)
+
+	resp2 = doReq("DELETE", "/v1/item/"+item.ID, "", nil)
+	require.Equal(t, http.StatusNoContent, resp2.StatusCode)
+	ev = readEvent(stream)
+	secondID := ev["id"]
+	require.Equal(t, strings.TrimSuffix(firstID, "1")+"2", secondID)
+	require.Equal(t, "item.deleted", ev["event"])
+	require.NoError(t, resp.Body.Close())
+
+	t.Run("test_resume", func(t *testing.T) {
+		resp, stream := watch(firstID)
+		t.Cleanup(func() { resp.Body.Close() })
+		ev := readEvent(stream)
+		require.Equal(t, secondID, ev["id"])
+		require.Equal(t, "item.deleted", ev["event"])
+	})
+
+	// ids that were not issued by this broker, e.g. before a restart
+	for _, lastID := range []string{"1", "0123456789ab-1", strings.TrimSuffix(firstID, "1") + "99"} {
+		t.Run("test_reset_"+lastID, func(t *testing.T) {
+			resp, stream := watch(lastID)
+			t.Cleanup(func() { resp.Body.Close() })
+			require.Equal(t, "reset", readEvent(stream)["event"])
+		})
+	}
+
+	t.Run("test_shutdown", func(t *testing.T) {
+		_, stream := watch("")
+		serv.StartShutdown()
+		_, err := stream.ReadString('\n')
+		require.ErrorIs(t, err, io.EOF)
+	})
+}
+
 func TestServer_DeleteItem(t *testing.T) {
 	t.Parallel()
 
@@ -333,17 +943,16 @@ func TestServer_DeleteItem(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, "PUT", ts.URL+"/item/-1", bytes.NewReader(b))
 		require.NoError(t, err)
 		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Content-Type", "application/json")
 		resp, err := ts.Client().Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
 		require.Equal(t, http.StatusNotFound, resp.StatusCode)
-		var resErr struct {
-			Error string `json:"error"`
-		}
+		var resErr errorBody
 		err = json.NewDecoder(resp.Body).Decode(&resErr)
 		require.NoError(t, err)
-		require.NotEmpty(t, resErr.Error)
-		require.Equal(t, strings.ToLower(resErr.Error), "not found")
+		require.NotEmpty(t, resErr.Message)
+		require.Equal(t, strings.ToLower(resErr.Message), "not found")
 	})
 
 	t.Run("test_ok", func(t *testing.T) {
@@ -353,6 +962,7 @@ func TestServer_DeleteItem(t *testing.T) {
 		req, err := http.NewRequestWithContext(ctx, "PUT", ts.URL+"/item/"+item.ID, bytes.NewReader(b))
 		require.NoError(t, err)
 		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Content-Type", "application/json")
 		resp, err := ts.Client().Do(req)
 		require.NoError(t, err)
 		defer resp.Body.Close()
@@ -395,38 +1005,814 @@ func TestServer_Authentication(t *testing.T) {
 	resp, err := ts.Client().Do(req)
 	require.NoError(t, err)
 	require.Equal(t, http.StatusNoContent, resp.StatusCode)
-	require.Equal(t, item.ID, mockRepo.DeleteItemIn)
+	require.Equal(t, item.ID, mockRepo.DeleteItemIn.ID)
 }
 
-func buildItem() types.Item {
-	now := time.Now()
-	return types.Item{
-		ID:        gofakeit.UUID(),
-		Name:      "test-item-" + gofakeit.LetterN(6),
-		Value:     "test-value-" + gofakeit.UUID(),
-		AccountID: gofakeit.UUID(),
-		CreatedAt: now,
-		UpdatedAt: now,
-	}
-}
+func TestServer_HealthCheck(t *testing.T) {
+	t.Parallel()
 
-func buildUser(accountID string) types.User {
-	return types.User{
-		ID:        gofakeit.UUID(),
-		Name:      gofakeit.Name(),
-		Email:     gofakeit.Email(),
-		AccountID: accountID,
-		Token:     gofakeit.UUID(),
-	}
-}
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
 
-func testListsEqual(t *testing.T, want, got []types.Item) {
-	t.Helper()
+	uamAPI, err := uam.NewAPI(uam.Config{}, &mock.Repository{}, memory.NewCache())
+	require.NoError(t, err)
 
-	require.Equal(t, len(want), len(got))
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, &mockAuthenticator{}, uamAPI)
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
 
-	slices.SortFunc(want, func(a, b types.Item) int {
-		return cmp.Compare(a.ID, b.ID)
+	getStatus := func() int {
+		resp, err := ts.Client().Get(ts.URL + "/health-check")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		return resp.StatusCode
+	}
+
+	serv.runHealthChecks(ctx)
+	require.Equal(t, http.StatusOK, getStatus())
+
+	serv.SetReady(false)
+	require.Equal(t, http.StatusServiceUnavailable, getStatus())
+	serv.SetReady(true)
+	require.Equal(t, http.StatusOK, getStatus())
+
+	serv.StartShutdown()
+	serv.SetReady(true)
+	require.Equal(t, http.StatusServiceUnavailable, getStatus())
+}
+
+func TestServer_Readiness(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, &mock.Repository{}, memory.NewCache())
+	require.NoError(t, err)
+
+	var searchDown, queueDown atomic.Bool
+	searchDown.Store(true)
+	check := func(down *atomic.Bool, err error) CheckFunc {
+		return func(ctx context.Context) error {
+			if down.Load() {
+				return err
+			}
+			return nil
+		}
+	}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, &mockAuthenticator{}, uamAPI,
+		WithHealthCheckConfig(time.Hour, time.Second),
+		WithHealthCheck("search", false, check(&searchDown, errors.New("search is down"))),
+		WithHealthCheck("queue", true, check(&queueDown, errors.New("connection refused"))),
+	)
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	getReadiness := func() (int, readinessBody) {
+		resp, err := ts.Client().Get(ts.URL + "/readyz")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body readinessBody
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		return resp.StatusCode, body
+	}
+
+	t.Run("liveness", func(t *testing.T) {
+		resp, err := ts.Client().Get(ts.URL + "/livez")
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.JSONEq(t, `{"status":"ok"}`, string(b))
+	})
+
+	serv.runHealthChecks(ctx)
+
+	// a failing non critical check is reported without failing the readiness check
+	status, body := getReadiness()
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, readinessOK, body.Status)
+	require.Len(t, body.Checks, 4)
+	require.Equal(t, checkStatusOK, body.Checks["repository"].Status)
+	require.True(t, body.Checks["repository"].Critical)
+	require.Equal(t, checkStatusOK, body.Checks["cache"].Status)
+	require.False(t, body.Checks["cache"].Critical)
+	require.Equal(t, checkStatusFailing, body.Checks["search"].Status)
+	require.Equal(t, "search is down", body.Checks["search"].LastError)
+	require.NotNil(t, body.Checks["search"].CheckedAt)
+
+	// the last error is kept after the check recovers
+	searchDown.Store(false)
+	serv.runHealthChecks(ctx)
+	_, body = getReadiness()
+	require.Equal(t, checkStatusOK, body.Checks["search"].Status)
+	require.Equal(t, "search is down", body.Checks["search"].LastError)
+
+	// a failing critical check fails the readiness check
+	queueDown.Store(true)
+	serv.runHealthChecks(ctx)
+	status, body = getReadiness()
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, readinessUnhealthy, body.Status)
+	require.Equal(t, checkStatusFailing, body.Checks["queue"].Status)
+	require.Equal(t, "connection refused", body.Checks["queue"].LastError)
+
+	queueDown.Store(false)
+	serv.runHealthChecks(ctx)
+	serv.SetReady(false)
+	status, body = getReadiness()
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, readinessStarting, body.Status)
+
+	serv.SetReady(true)
+	serv.StartShutdown()
+	status, body = getReadiness()
+	require.Equal(t, http.StatusServiceUnavailable, status)
+	require.Equal(t, readinessShuttingDown, body.Status)
+}
+
+func TestServer_Admin(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := buildItem()
+	mockRepo := &mock.Repository{GetItemByNameRes: item}
+	uamAPI, err := uam.NewAPI(uam.Config{CacheEnabled: true}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(item.AccountID)
+	v := validator.New(validator.WithRequiredStructEnabled())
+	configView := func() map[string]any { return map[string]any{"ADMIN_TOKEN": "[REDACTED]"} }
+	serv, err := New(ctx, v, &mockAuthenticator{user: user}, uamAPI, WithAdmin("admin-token", configView))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	do := func(method, path, token, body string) (*http.Response, string) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		if body != "" {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		b, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, string(b)
+	}
+	admin := func(method, path, body string) (*http.Response, string) {
+		return do(method, path, "admin-token", body)
+	}
+
+	t.Run("unauthorized", func(t *testing.T) {
+		resp, _ := do(http.MethodGet, "/admin/cache", "", "")
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+		// user tokens are not admin tokens
+		resp, _ = do(http.MethodGet, "/admin/cache", user.Token, "")
+		require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+	})
+
+	// cache the item
+	resp, _ := do(http.MethodGet, "/v1/item/"+item.Name, user.Token, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	key := url.PathEscape("item:" + item.AccountID + ":" + item.Name)
+	resp, body := admin(http.MethodGet, "/admin/cache/entries/"+key, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var entry struct {
+		Key   string     `json:"key"`
+		Value types.Item `json:"value"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(body), &entry))
+	require.Equal(t, item.ID, entry.Value.ID)
+
+	resp, _ = admin(http.MethodDelete, "/admin/cache/entries", "")
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, body = admin(http.MethodDelete, "/admin/cache/entries?account_id="+item.AccountID, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{"deleted":1}`, body)
+	resp, _ = admin(http.MethodGet, "/admin/cache/entries/"+key, "")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+
+	resp, body = admin(http.MethodPut, "/admin/cache", `{"enabled":false}`)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{"enabled":false}`, body)
+	require.False(t, uamAPI.CacheEnabled())
+	resp, _ = admin(http.MethodPut, "/admin/cache", `{}`)
+	require.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	resp, body = admin(http.MethodGet, "/admin/cache", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{"enabled":false}`, body)
+
+	resp, body = admin(http.MethodPost, "/admin/health-checks", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var readiness readinessBody
+	require.NoError(t, json.Unmarshal([]byte(body), &readiness))
+	require.Equal(t, readinessOK, readiness.Status)
+	require.Equal(t, checkStatusOK, readiness.Checks["repository"].Status)
+
+	resp, body = admin(http.MethodGet, "/admin/config", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, `{"ADMIN_TOKEN":"[REDACTED]"}`, body)
+
+	t.Run("not_mounted_without_token", func(t *testing.T) {
+		serv, err := New(ctx, v, &mockAuthenticator{}, uamAPI)
+		require.NoError(t, err)
+		serv.MountHandlers()
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/admin/cache", nil)
+		req.Header.Set("Authorization", "Bearer ")
+		serv.Router().ServeHTTP(rec, req)
+		require.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestServer_AdminAuthFailures(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, &mock.Repository{}, memory.NewCache())
+	require.NoError(t, err)
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, &mockAuthenticator{}, uamAPI, WithAdmin("admin-token", nil))
+	require.NoError(t, err)
+	now := time.Now()
+	serv.adminFailures.now = func() time.Time { return now }
+	serv.MountHandlers()
+
+	do := func(remoteAddr, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/admin/stats", nil)
+		req.RemoteAddr = remoteAddr
+		req.Header.Set("Authorization", "Bearer "+token)
+		rec := httptest.NewRecorder()
+		serv.Router().ServeHTTP(rec, req)
+		return rec
+	}
+
+	for range adminMaxFailures {
+		require.Equal(t, http.StatusUnauthorized, do("10.0.0.1:1234", "guess").Code)
+	}
+	// blocked even with the right token, so guesses can't be told apart from the responses
+	rec := do("10.0.0.1:4321", "admin-token")
+	require.Equal(t, http.StatusTooManyRequests, rec.Code)
+	require.Equal(t, "60", rec.Header().Get("Retry-After"))
+
+	// other client IPs are not blocked
+	require.Equal(t, http.StatusOK, do("10.0.0.2:1234", "admin-token").Code)
+
+	now = now.Add(adminFailureWindow)
+	require.Equal(t, http.StatusOK, do("10.0.0.1:1234", "admin-token").Code)
+}
+
+func TestServer_ConditionalRequests(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := buildItem()
+	item.Version = 3
+	mockRepo := &mock.Repository{
+		GetItemByNameRes: item,
+		UpdateItemRes:    item,
+		ListItemsRes:     []types.Item{item},
+	}
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(item.AccountID)
+	mockAuth := &mockAuthenticator{user: user}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, mockAuth, uamAPI)
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	doReq := func(method, path string, headers map[string]string, body any) *http.Response {
+		var r io.Reader
+		if body != nil {
+			b, err := json.Marshal(body)
+			require.NoError(t, err)
+			r = bytes.NewReader(b)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, ts.URL+path, r)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for _, path := range []string{"/item/" + item.Name, "/items"} {
+		t.Run("test_if_none_match_"+path, func(t *testing.T) {
+			resp := doReq("GET", path, nil, nil)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			etag := resp.Header.Get("ETag")
+			require.NotEmpty(t, etag)
+
+			resp = doReq("GET", path, map[string]string{"If-None-Match": `"other", W/` + etag}, nil)
+			require.Equal(t, http.StatusNotModified, resp.StatusCode)
+			require.Equal(t, etag, resp.Header.Get("ETag"))
+
+			resp = doReq("GET", path, map[string]string{"If-None-Match": `"other"`}, nil)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+		})
+	}
+
+	t.Run("test_if_match", func(t *testing.T) {
+		input := types.UpdateItemInput{Name: item.Name, Value: "new value"}
+		resp := doReq("PUT", "/item/"+item.ID, map[string]string{"If-Match": itemETag(item)}, input)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, item.Version, mockRepo.UpdateItemIn.ExpectedVersion)
+		require.Equal(t, itemETag(item), resp.Header.Get("ETag"))
+
+		resp = doReq("DELETE", "/item/"+item.ID, map[string]string{"If-Match": itemETag(item)}, nil)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, types.DeleteItemInput{ID: item.ID, ExpectedVersion: item.Version}, mockRepo.DeleteItemIn)
+
+		resp = doReq("DELETE", "/item/"+item.ID, map[string]string{"If-Match": "*"}, nil)
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Zero(t, mockRepo.DeleteItemIn.ExpectedVersion)
+	})
+
+	t.Run("test_if_match_other_item", func(t *testing.T) {
+		other := buildItem()
+		resp := doReq("DELETE", "/item/"+item.ID, map[string]string{"If-Match": itemETag(other)}, nil)
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+		var body errorBody
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Equal(t, errs.ErrorCodePrecondition, body.Code)
+	})
+
+	t.Run("test_version_mismatch", func(t *testing.T) {
+		mockRepo.ReturnErr = errs.NewPreconditionFailedErr(nil, "item is not at version 1")
+		t.Cleanup(func() { mockRepo.ReturnErr = nil })
+		input := types.UpdateItemInput{Name: item.Name, Value: "new value"}
+		resp := doReq("PUT", "/item/"+item.ID, map[string]string{"If-Match": itemETag(item)}, input)
+		require.Equal(t, http.StatusPreconditionFailed, resp.StatusCode)
+	})
+}
+
+func TestServer_Idempotency(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := buildItem()
+	mockRepo := &mock.Repository{SaveItemRes: item}
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(item.AccountID)
+	mockAuth := &mockAuthenticator{user: user}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, mockAuth, uamAPI, WithIdempotency(memory.NewCache(), time.Hour))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	// a handler that writes nothing
+	serv.Router().With(serv.AuthMiddleware, serv.IdempotencyMiddleware).Post("/noop", func(http.ResponseWriter, *http.Request) {})
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	post := func(path, key string, input types.ItemCreateInput) (*http.Response, []byte) {
+		b, err := json.Marshal(input)
+		require.NoError(t, err)
+		req, err := http.NewRequestWithContext(ctx, "POST", ts.URL+path, bytes.NewReader(b))
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		body, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp, body
+	}
+	addItem := func(key string, input types.ItemCreateInput) (*http.Response, []byte) {
+		return post("/item", key, input)
+	}
+
+	input := types.ItemCreateInput{Name: item.Name, Value: item.Value}
+	resp, firstBody := addItem("key-1", input)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	require.Empty(t, resp.Header.Get("Idempotent-Replayed"))
+
+	t.Run("test_replay", func(t *testing.T) {
+		// the retry is not sent to the repository, which would fail on the duplicate name
+		mockRepo.ReturnErr = errs.NewAppErr(errors.New("duplicate"), "", errs.ErrorCodeDuplicate)
+		t.Cleanup(func() { mockRepo.ReturnErr = nil })
+		resp, body := addItem("key-1", input)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		require.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+		require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+		require.Equal(t, firstBody, body)
+	})
+
+	t.Run("test_key_reused", func(t *testing.T) {
+		resp, body := addItem("key-1", types.ItemCreateInput{Name: "other-item"})
+		require.Equal(t, http.StatusUnprocessableEntity, resp.StatusCode)
+		var resErr errorBody
+		require.NoError(t, json.Unmarshal(body, &resErr))
+		require.Equal(t, errs.ErrorCodeIdempotency, resErr.Code)
+	})
+
+	t.Run("test_server_errors_not_stored", func(t *testing.T) {
+		mockRepo.ReturnErr = errors.New("db is down")
+		resp, _ := addItem("key-2", input)
+		require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+		mockRepo.ReturnErr = nil
+		resp, _ = addItem("key-2", input)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Idempotent-Replayed"))
+	})
+
+	t.Run("test_empty_response", func(t *testing.T) {
+		resp, body := post("/noop", "key-3", input)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, body)
+		resp, body = post("/noop", "key-3", input)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "true", resp.Header.Get("Idempotent-Replayed"))
+		require.Empty(t, body)
+	})
+}
+
+func TestServer_APIVersions(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := buildItem()
+	mockRepo := &mock.Repository{GetItemByNameRes: item}
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(item.AccountID)
+	mockAuth := &mockAuthenticator{user: user}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	deprecatedAt := time.Date(2026, time.January, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2027, time.January, 1, 0, 0, 0, 0, time.UTC)
+	serv, err := New(ctx, v, mockAuth, uamAPI, WithRootDeprecation(deprecatedAt, sunset))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	// a version with another envelope served over the same handlers
+	v2 := apiVersion{name: "v2", envelope: func(_ *http.Request, val any) any {
+		return map[string]any{"data": val}
+	}}
+	serv.Router().Route("/v2", func(r chi.Router) {
+		serv.mountItemRoutes(r, v2)
+	})
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	get := func(path string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, "GET", ts.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		return resp
+	}
+
+	t.Run("test_v1", func(t *testing.T) {
+		resp := get("/v1/item/" + item.Name)
+		require.Empty(t, resp.Header.Get("Deprecation"))
+		var gotItem types.Item
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&gotItem))
+		require.Equal(t, item.ID, gotItem.ID)
+	})
+
+	t.Run("test_root_deprecated", func(t *testing.T) {
+		resp := get("/item/" + item.Name)
+		require.Equal(t, "@1767225600", resp.Header.Get("Deprecation"))
+		require.Equal(t, "Fri, 01 Jan 2027 00:00:00 GMT", resp.Header.Get("Sunset"))
+		require.Equal(t, `</v1/item/`+item.Name+`>; rel="successor-version"`, resp.Header.Get("Link"))
+		var gotItem types.Item
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&gotItem))
+		require.Equal(t, item.ID, gotItem.ID)
+	})
+
+	t.Run("test_envelope", func(t *testing.T) {
+		resp := get("/v2/item/" + item.Name)
+		var body struct {
+			Data types.Item `json:"data"`
+		}
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		require.Equal(t, item.ID, body.Data.ID)
+	})
+}
+
+func TestServer_CORS(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := buildItem()
+	mockRepo := &mock.Repository{GetItemByNameRes: item}
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(item.AccountID)
+	mockAuth := &mockAuthenticator{user: user}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	const origin = "https://admin.example.com"
+	serv, err := New(ctx, v, mockAuth, uamAPI, WithCORS(CORSOptions{
+		AllowedOrigins:   []string{origin},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	}))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	doReq := func(method, path string, headers map[string]string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, method, ts.URL+path, nil)
+		require.NoError(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	t.Run("test_preflight", func(t *testing.T) {
+		// preflight requests are answered without a bearer token
+		resp := doReq("OPTIONS", "/v1/item/"+item.ID, map[string]string{
+			"Origin":                         origin,
+			"Access-Control-Request-Method":  "PUT",
+			"Access-Control-Request-Headers": "authorization, content-type, if-match",
+		})
+		require.Equal(t, http.StatusNoContent, resp.StatusCode)
+		require.Equal(t, origin, resp.Header.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "true", resp.Header.Get("Access-Control-Allow-Credentials"))
+		require.Contains(t, resp.Header.Get("Access-Control-Allow-Methods"), "PUT")
+		require.Equal(t, "authorization, content-type, if-match", resp.Header.Get("Access-Control-Allow-Headers"))
+		require.Equal(t, "600", resp.Header.Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("test_preflight_not_allowed", func(t *testing.T) {
+		tests := map[string]map[string]string{
+			"origin": {"Origin": "https://evil.example.com", "Access-Control-Request-Method": "GET"},
+			"method": {"Origin": origin, "Access-Control-Request-Method": "TRACE"},
+			"header": {"Origin": origin, "Access-Control-Request-Method": "GET", "Access-Control-Request-Headers": "x-custom"},
+		}
+		for name, headers := range tests {
+			resp := doReq("OPTIONS", "/v1/items", headers)
+			require.Equal(t, http.StatusNoContent, resp.StatusCode, name)
+			require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"), name)
+		}
+	})
+
+	t.Run("test_request", func(t *testing.T) {
+		resp := doReq("GET", "/v1/item/"+item.Name, map[string]string{
+			"Origin":        origin,
+			"Authorization": "BEARER " + user.Token,
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, origin, resp.Header.Get("Access-Control-Allow-Origin"))
+		require.Contains(t, resp.Header.Get("Access-Control-Expose-Headers"), "ETag")
+		require.Contains(t, resp.Header.Values("Vary"), "Origin")
+
+		resp = doReq("GET", "/v1/item/"+item.Name, map[string]string{
+			"Origin":        "https://evil.example.com",
+			"Authorization": "BEARER " + user.Token,
+		})
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Access-Control-Allow-Origin"))
+	})
+}
+
+func TestServer_Compression(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	items := make([]types.Item, 20)
+	for i := range items {
+		items[i] = buildItem()
+	}
+	mockRepo := &mock.Repository{ListItemsRes: items, GetItemByNameRes: items[0]}
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(items[0].AccountID)
+	mockAuth := &mockAuthenticator{user: user}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, mockAuth, uamAPI)
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	doReq := func(path, acceptEncoding string, headers ...string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, "GET", ts.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		// setting the header stops the transport from decompressing the body
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		for i := 0; i+1 < len(headers); i += 2 {
+			req.Header.Set(headers[i], headers[i+1])
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	decoders := map[string]func(io.Reader) (io.Reader, error){
+		"gzip": func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		"zstd": func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+	for encoding, decode := range decoders {
+		t.Run("test_"+encoding, func(t *testing.T) {
+			resp := doReq("/v1/items", encoding)
+			require.Equal(t, http.StatusOK, resp.StatusCode)
+			require.Equal(t, encoding, resp.Header.Get("Content-Encoding"))
+			require.Contains(t, resp.Header.Values("Vary"), "Accept-Encoding")
+			require.True(t, strings.HasSuffix(resp.Header.Get("ETag"), "-"+encoding+`"`), resp.Header.Get("ETag"))
+			body, err := decode(resp.Body)
+			require.NoError(t, err)
+			var gotItems []types.Item
+			require.NoError(t, json.NewDecoder(body).Decode(&gotItems))
+			require.Len(t, gotItems, len(items))
+		})
+	}
+
+	t.Run("test_small_body", func(t *testing.T) {
+		resp := doReq("/v1/item/"+items[0].Name, "gzip")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Content-Encoding"))
+		require.Equal(t, itemETag(items[0]), resp.Header.Get("ETag"))
+		var gotItem types.Item
+		require.NoError(t, json.NewDecoder(resp.Body).Decode(&gotItem))
+		require.Equal(t, items[0].ID, gotItem.ID)
+	})
+
+	t.Run("test_not_modified", func(t *testing.T) {
+		resp := doReq("/v1/items", "gzip")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		etag := resp.Header.Get("ETag")
+		resp = doReq("/v1/items", "gzip", "If-None-Match", etag)
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Content-Encoding"))
+		require.Equal(t, etag, resp.Header.Get("ETag"))
+
+		// the tag of the compressed list matches the uncompressed list too
+		resp = doReq("/v1/items", "identity", "If-None-Match", etag)
+		require.Equal(t, http.StatusNotModified, resp.StatusCode)
+	})
+
+	t.Run("test_if_match_compressed_etag", func(t *testing.T) {
+		item := items[0]
+		item.Version = 3
+		version, err := expectedVersion(encodedETag(itemETag(item), encodingGzip), item.ID)
+		require.NoError(t, err)
+		require.Equal(t, item.Version, version)
+	})
+
+	t.Run("test_identity", func(t *testing.T) {
+		resp := doReq("/v1/items", "gzip;q=0, br")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Empty(t, resp.Header.Get("Content-Encoding"))
+	})
+}
+
+func TestNegotiateEncoding(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"":                        "",
+		"gzip":                    "gzip",
+		"gzip, deflate, br, zstd": "zstd",
+		"zstd;q=0.5, gzip":        "gzip",
+		"*":                       "zstd",
+		"*;q=0, gzip;q=0.1":       "gzip",
+		"identity":                "",
+		"gzip;q=0":                "",
+	}
+	for header, want := range tests {
+		require.Equal(t, want, negotiateEncoding(header, supportedEncodings), header)
+	}
+
+	// without zstd
+	require.Equal(t, "gzip", negotiateEncoding("zstd, gzip;q=0.5", []string{encodingGzip}))
+	require.Equal(t, "gzip", negotiateEncoding("*", []string{encodingGzip}))
+	require.Empty(t, negotiateEncoding("zstd", []string{encodingGzip}))
+}
+
+func TestServer_RateLimit(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := buildItem()
+	mockRepo := &mock.Repository{GetItemByNameRes: item}
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, mockRepo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(item.AccountID)
+	mockAuth := &mockAuthenticator{user: user}
+	v := validator.New(validator.WithRequiredStructEnabled())
+	limits := map[string]ratelimit.Limit{RateLimitGroupRead: {Requests: 1, Per: time.Minute, Burst: 2}}
+	serv, err := New(ctx, v, mockAuth, uamAPI, WithRateLimiter(ratelimitmemory.NewLimiter(), limits))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	doReq := func(method, path string) *http.Response {
+		req, err := http.NewRequestWithContext(ctx, method, ts.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "BEARER "+user.Token)
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() { resp.Body.Close() })
+		return resp
+	}
+
+	for i := range 2 {
+		resp := doReq("GET", "/item/"+item.Name)
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+		require.Equal(t, "2", resp.Header.Get("RateLimit-Limit"))
+		require.Equal(t, strconv.Itoa(1-i), resp.Header.Get("RateLimit-Remaining"))
+	}
+
+	resp := doReq("GET", "/items")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode)
+	require.Equal(t, "60", resp.Header.Get("Retry-After"))
+	require.Equal(t, "0", resp.Header.Get("RateLimit-Remaining"))
+	var body errorBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	require.Equal(t, errs.ErrorCodeRateLimited, body.Code)
+
+	// groups without a limit are not limited
+	resp = doReq("DELETE", "/item/"+item.ID)
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	require.Empty(t, resp.Header.Get("RateLimit-Limit"))
+}
+
+func buildItem() types.Item {
+	now := time.Now()
+	return types.Item{
+		ID:        gofakeit.UUID(),
+		Name:      "test-item-" + gofakeit.LetterN(6),
+		Value:     "test-value-" + gofakeit.UUID(),
+		AccountID: gofakeit.UUID(),
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+}
+
+func buildUser(accountID string) types.User {
+	return types.User{
+		ID:        gofakeit.UUID(),
+		Name:      gofakeit.Name(),
+		Email:     gofakeit.Email(),
+		AccountID: accountID,
+		Token:     gofakeit.UUID(),
+	}
+}
+
+func testListsEqual(t *testing.T, want, got []types.Item) {
+	t.Helper()
+
+	require.Equal(t, len(want), len(got))
+
+	slices.SortFunc(want, func(a, b types.Item) int {
+		return cmp.Compare(a.ID, b.ID)
 	})
 	slices.SortFunc(got, func(a, b types.Item) int {
 		return cmp.Compare(a.ID, b.ID)
@@ -440,6 +1826,438 @@ func testListsEqual(t *testing.T, want, got []types.Item) {
 	}
 }
 
+func TestServer_Recover(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, &mock.Repository{}, memory.NewCache())
+	require.NoError(t, err)
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, &mockAuthenticator{}, uamAPI, WithAdmin("admin-token", nil),
+		WithCORS(CORSOptions{AllowedOrigins: []string{"https://app.example.com"}}))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	serv.Router().Get("/panic", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"1"`)
+		w.Header().Set("Content-Type", "text/csv")
+		w.Header().Set("Content-Disposition", `attachment; filename="items.csv"`)
+		w.Header().Set("Content-Length", "100")
+		panic("boom")
+	})
+	// the handlers run on the server goroutines, so their errors are checked by the test
+	flushErrs := make(chan error, 1)
+	serv.Router().Get("/panic-after-write", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("partial"))
+		flushErrs <- http.NewResponseController(w).Flush()
+		panic("boom")
+	})
+	serv.Router().Get("/abort", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+		panic(http.ErrAbortHandler)
+	})
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/panic", nil)
+	require.NoError(t, err)
+	req.Header.Set("Origin", "https://app.example.com")
+	resp, err := ts.Client().Do(req)
+	require.NoError(t, err)
+	var body errorBody
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+	resp.Body.Close()
+	require.Equal(t, http.StatusInternalServerError, resp.StatusCode)
+	require.Equal(t, errs.ErrorCodeInternal, body.Code)
+	require.Equal(t, "Something went wrong", body.Message)
+	require.NotEmpty(t, body.TraceID)
+	// the headers of the handler are dropped, the headers of the middlewares are kept
+	require.Equal(t, "application/json", resp.Header.Get("Content-Type"))
+	require.Empty(t, resp.Header.Get("ETag"))
+	require.Empty(t, resp.Header.Get("Content-Disposition"))
+	require.Equal(t, "https://app.example.com", resp.Header.Get("Access-Control-Allow-Origin"))
+	require.NotEmpty(t, resp.Header.Get(headerRequestID))
+
+	// the partial response reached the client before the panic, the connection is aborted so the client can't take
+	// it as complete. The response is not compressed, so the partial body is not buffered by the compression.
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/panic-after-write", nil)
+	require.NoError(t, err)
+	req.Header.Set("Accept-Encoding", "identity")
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	b, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	require.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	require.Equal(t, "partial", string(b))
+	require.NoError(t, <-flushErrs)
+
+	// aborts are not counted as panics
+	resp, err = ts.Client().Get(ts.URL + "/abort")
+	if err == nil {
+		_, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+	}
+	require.Equal(t, uint64(2), serv.Panics())
+
+	req, err = http.NewRequest(http.MethodGet, ts.URL+"/admin/stats", nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Bearer admin-token")
+	resp, err = ts.Client().Do(req)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	b, err = io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"panics":2}`, string(b))
+}
+
+// slowRepository blocks reads until their context is done, like a database that does not answer.
+type slowRepository struct {
+	*mock.Repository
+	streamDeadline atomic.Bool
+}
+
+func (r *slowRepository) GetItemByName(ctx context.Context, _, _ string) (types.Item, error) {
+	<-ctx.Done()
+	return types.Item{}, ctx.Err()
+}
+
+func (r *slowRepository) ListItems(ctx context.Context, _ types.ListItemsInput, _ string) ([]types.Item, error) {
+	<-ctx.Done()
+	return nil, fmt.Errorf("failed to list items: %w", ctx.Err())
+}
+
+func (r *slowRepository) StreamItems(ctx context.Context, _ string, _ func(types.Item) error) error {
+	_, ok := ctx.Deadline()
+	r.streamDeadline.Store(ok)
+	return nil
+}
+
+func TestServer_Timeouts(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	repo := &slowRepository{Repository: &mock.Repository{}}
+	uamAPI, err := uam.NewAPI(uam.Config{}, repo, memory.NewCache())
+	require.NoError(t, err)
+
+	user := buildUser(gofakeit.UUID())
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, &mockAuthenticator{user: user}, uamAPI,
+		WithRouteTimeouts(map[string]time.Duration{RouteGroupRead: 50 * time.Millisecond}),
+	)
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	get := func(path string) (*http.Response, errorBody) {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("Authorization", "Bearer "+user.Token)
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		var body errorBody
+		if resp.Header.Get("Content-Type") == "application/json" {
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+		}
+		return resp, body
+	}
+
+	for _, path := range []string{"/v1/item/name", "/v1/items"} {
+		start := time.Now()
+		resp, body := get(path)
+		require.Equal(t, http.StatusGatewayTimeout, resp.StatusCode, path)
+		require.Equal(t, errs.ErrorCodeTimeout, body.Code)
+		require.Less(t, time.Since(start), 5*time.Second)
+	}
+
+	// streams have no deadline
+	resp, _ := get("/v1/items/export")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.False(t, repo.streamDeadline.Load())
+
+	t.Run("specific_codes_are_kept", func(t *testing.T) {
+		err := errs.NewNotFoundErr(context.DeadlineExceeded, "item not found")
+		status, appErr, _ := parseErr(fmt.Errorf("get item: %w", err))
+		require.Equal(t, http.StatusNotFound, status)
+		require.Equal(t, errs.ErrorCodeNotFound, appErr.Code)
+
+		status, appErr, _ = parseErr(errs.NewInternalServerErr(context.DeadlineExceeded, ""))
+		require.Equal(t, http.StatusGatewayTimeout, status)
+		require.Equal(t, errs.ErrorCodeTimeout, appErr.Code)
+	})
+}
+
+func TestServer_TraceContext(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	uamAPI, err := uam.NewAPI(uam.Config{}, &mock.Repository{}, memory.NewCache())
+	require.NoError(t, err)
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, &mockAuthenticator{}, uamAPI)
+	require.NoError(t, err)
+	serv.MountHandlers()
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	const traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+	tests := map[string]struct {
+		traceParent   string
+		requestID     string
+		wantTraceID   string
+		wantFlags     string
+		wantRequestID string
+	}{
+		"inbound": {
+			traceParent:   "00-" + traceID + "-00f067aa0ba902b7-01",
+			requestID:     "req-123",
+			wantTraceID:   traceID,
+			wantFlags:     "01",
+			wantRequestID: "req-123",
+		},
+		"invalid": {
+			traceParent: "00-" + strings.Repeat("0", 32) + "-00f067aa0ba902b7-01",
+			requestID:   "bad id\twith spaces",
+			wantFlags:   "00",
+		},
+		"missing": {wantFlags: "00"},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			// unauthenticated, so the ids are in the error body too
+			req, err := http.NewRequest(http.MethodGet, ts.URL+"/v1/items", nil)
+			require.NoError(t, err)
+			if tc.traceParent != "" {
+				req.Header.Set("traceparent", tc.traceParent)
+			}
+			if tc.requestID != "" {
+				req.Header.Set("X-Request-ID", tc.requestID)
+			}
+			resp, err := ts.Client().Do(req)
+			require.NoError(t, err)
+			defer resp.Body.Close()
+			require.Equal(t, http.StatusUnauthorized, resp.StatusCode)
+			var body errorBody
+			require.NoError(t, json.NewDecoder(resp.Body).Decode(&body))
+
+			tr, ok := parseTraceParent(resp.Header.Get("traceresponse"))
+			require.True(t, ok)
+			require.Equal(t, tc.wantFlags, tr.flags)
+			require.Equal(t, tr.traceID, body.TraceID)
+			if tc.wantTraceID != "" {
+				require.Equal(t, tc.wantTraceID, tr.traceID)
+			}
+			requestID := resp.Header.Get("X-Request-ID")
+			require.NotEmpty(t, requestID)
+			require.Equal(t, requestID, body.RequestID)
+			if tc.wantRequestID != "" {
+				require.Equal(t, tc.wantRequestID, requestID)
+			} else {
+				require.NotEqual(t, tc.requestID, requestID)
+			}
+		})
+	}
+}
+
+// logRecorder keeps the lines written by the default logger while a test runs.
+type logRecorder struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+// recordLogs makes the default logger write to the returned recorder until the test ends. The default logger is
+// shared by the whole package, so tests calling it must not run in parallel.
+func recordLogs(t *testing.T) *logRecorder {
+	l := &logRecorder{}
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewJSONHandler(l, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return l
+}
+
+func (l *logRecorder) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.buf.Write(p)
+}
+
+type logLine struct {
+	Level string `json:"level"`
+	Msg   string `json:"msg"`
+}
+
+// lines returns the logged lines with a message containing substr.
+func (l *logRecorder) lines(t *testing.T, substr string) []logLine {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	var res []logLine
+	for _, b := range bytes.Split(l.buf.Bytes(), []byte("\n")) {
+		var line logLine
+		if len(b) == 0 {
+			continue
+		}
+		require.NoError(t, json.Unmarshal(b, &line))
+		if strings.Contains(line.Msg, substr) {
+			res = append(res, line)
+		}
+	}
+	return res
+}
+
+// accessLogFields parses the key=value fields of an access log message.
+func accessLogFields(t *testing.T, msg string) map[string]string {
+	_, msg, ok := strings.Cut(msg, ": ")
+	require.True(t, ok)
+	fields := make(map[string]string)
+	for _, f := range strings.Fields(msg) {
+		k, v, ok := strings.Cut(f, "=")
+		require.True(t, ok, f)
+		if uv, err := strconv.Unquote(v); err == nil {
+			v = uv
+		}
+		fields[k] = v
+	}
+	return fields
+}
+
+// TestServer_AccessLog does not run in parallel, as it records the logs of the default logger.
+func TestServer_AccessLog(t *testing.T) {
+	logs := recordLogs(t)
+	ctx := context.Background()
+
+	item := buildItem()
+	uamAPI, err := uam.NewAPI(uam.Config{}, &mock.Repository{GetItemByNameRes: item}, memory.NewCache())
+	require.NoError(t, err)
+	user := buildUser(item.AccountID)
+	v := validator.New(validator.WithRequiredStructEnabled())
+	serv, err := New(ctx, v, &mockAuthenticator{user: user}, uamAPI, WithAccessLog(AccessLogOptions{
+		ExcludePaths:  []string{"/openapi.json", "/v1/items/*"},
+		SlowThreshold: time.Hour,
+	}))
+	require.NoError(t, err)
+	serv.MountHandlers()
+	// not a GET, which the client would retry on the aborted connection. The handler runs on a server goroutine,
+	// so its error is checked by the test.
+	flushErrs := make(chan error, 1)
+	serv.Router().Post("/abort", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusAccepted)
+		_, _ = w.Write([]byte("partial"))
+		flushErrs <- http.NewResponseController(w).Flush()
+		panic(http.ErrAbortHandler)
+	})
+	ts := httptest.NewServer(serv.Router())
+	t.Cleanup(ts.Close)
+
+	const userAgent = "access-log-test"
+	send := func(method, path, token string) {
+		req, err := http.NewRequest(method, ts.URL+path, nil)
+		require.NoError(t, err)
+		req.Header.Set("User-Agent", userAgent)
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		// the body of the aborted request can't be read to the end
+		_, _ = io.Copy(io.Discard, resp.Body)
+		resp.Body.Close()
+	}
+
+	send(http.MethodGet, "/v1/item/"+item.Name, user.Token)
+	send(http.MethodGet, "/item/"+item.Name, "")
+	send(http.MethodGet, "/unknown/"+item.Name, "")
+	send(http.MethodPost, "/abort", "")
+	require.NoError(t, <-flushErrs)
+	// excluded
+	send(http.MethodGet, "/livez", "")
+	send(http.MethodGet, "/openapi.json", "")
+	send(http.MethodGet, "/v1/items/export", user.Token)
+
+	lines := logs.lines(t, fmt.Sprintf("user_agent=%q", userAgent))
+	require.Len(t, lines, 4)
+	for _, line := range lines {
+		require.NotContains(t, line.Msg, item.Name)
+	}
+
+	require.Equal(t, "INFO", lines[0].Level)
+	e := accessLogFields(t, lines[0].Msg)
+	require.Equal(t, http.MethodGet, e["method"])
+	require.Equal(t, "/v1/item/{name}", e["route"])
+	require.Equal(t, "200", e["status"])
+	require.NotEqual(t, "0", e["bytes"])
+	latency, err := time.ParseDuration(e["latency"])
+	require.NoError(t, err)
+	require.Positive(t, latency)
+	require.NotEmpty(t, e["remote_addr"])
+	require.Equal(t, item.AccountID, e["account_id"])
+	require.Equal(t, user.ID, e["user_id"])
+
+	// the deprecated alias, the user is not known as authentication failed
+	e = accessLogFields(t, lines[1].Msg)
+	require.Equal(t, "/item/{name}", e["route"])
+	require.Equal(t, "401", e["status"])
+	require.Empty(t, e["account_id"])
+
+	e = accessLogFields(t, lines[2].Msg)
+	require.Equal(t, "-", e["route"])
+	require.Equal(t, "404", e["status"])
+
+	// aborted requests are logged too
+	require.Equal(t, "WARN", lines[3].Level)
+	require.True(t, strings.HasPrefix(lines[3].Msg, "Aborted request: "))
+	e = accessLogFields(t, lines[3].Msg)
+	require.Equal(t, http.MethodPost, e["method"])
+	require.Equal(t, "/abort", e["route"])
+	require.Equal(t, "202", e["status"])
+
+	t.Run("slow", func(t *testing.T) {
+		serv, err := New(ctx, v, &mockAuthenticator{user: user}, uamAPI, WithAccessLog(AccessLogOptions{SlowThreshold: time.Nanosecond}))
+		require.NoError(t, err)
+		serv.MountHandlers()
+		req := httptest.NewRequest(http.MethodGet, "/v1/item/"+item.Name, nil)
+		req.Header.Set("Authorization", "Bearer "+user.Token)
+		req.Header.Set("User-Agent", "access-log-slow-test")
+		serv.Router().ServeHTTP(httptest.NewRecorder(), req)
+
+		lines := logs.lines(t, `user_agent="access-log-slow-test"`)
+		require.Len(t, lines, 1)
+		require.Equal(t, "WARN", lines[0].Level)
+		require.True(t, strings.HasPrefix(lines[0].Msg, "Slow request: "))
+	})
+}
+
+func TestParseTraceParent(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]struct {
+		header string
+		want   traceParent
+		wantOK bool
+	}{
+		"valid":           {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", traceParent{"4bf92f3577b34da6a3ce929d0e0e4736", "01"}, true},
+		"future_version":  {"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-extra", traceParent{"4bf92f3577b34da6a3ce929d0e0e4736", "00"}, true},
+		"extra_in_v00":    {"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra", traceParent{}, false},
+		"invalid_version": {"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", traceParent{}, false},
+		"zero_trace_id":   {"00-00000000000000000000000000000000-00f067aa0ba902b7-01", traceParent{}, false},
+		"zero_parent_id":  {"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", traceParent{}, false},
+		"uppercase":       {"00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-01", traceParent{}, false},
+		"short_trace_id":  {"00-4bf92f3577b34da6-00f067aa0ba902b7-01", traceParent{}, false},
+		"empty":           {"", traceParent{}, false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := parseTraceParent(tc.header)
+			require.Equal(t, tc.wantOK, ok)
+			require.Equal(t, tc.want, got)
+		})
+	}
+}
+
 func TestBearerAuthHeader(t *testing.T) {
 	t.Parallel()
 
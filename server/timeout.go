@@ -0,0 +1,46 @@
+package server
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Route groups with a timeout, the streaming routes have no timeout.
+const (
+	RouteGroupRead   = "read"
+	RouteGroupWrite  = "write"
+	RouteGroupImport = "import"
+)
+
+// defaultRouteTimeouts are the time budgets of the route groups, imports are not limited by default.
+var defaultRouteTimeouts = map[string]time.Duration{
+	RouteGroupRead:  10 * time.Second,
+	RouteGroupWrite: 15 * time.Second,
+}
+
+// WithRouteTimeouts sets the time budget of the requests to every route group in timeouts, groups not in timeouts
+// keep their default and a zero timeout removes the limit of a group.
+func WithRouteTimeouts(timeouts map[string]time.Duration) Option {
+	return func(s *Server) {
+		for group, d := range timeouts {
+			s.routeTimeouts[group] = d
+		}
+	}
+}
+
+// TimeoutMiddleware sets the deadline of the requests to the routes of group on their context, so the calls to the
+// repository and the cache are cancelled once it passes and the request fails with a timeout error.
+func (s *Server) TimeoutMiddleware(group string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		timeout := s.routeTimeouts[group]
+		if timeout <= 0 {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), timeout)
+			defer cancel()
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
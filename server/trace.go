@@ -0,0 +1,83 @@
+package server
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"github.com/google/uuid"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+const (
+	headerTraceParent   = "traceparent"
+	headerTraceResponse = "traceresponse"
+	headerRequestID     = "X-Request-ID"
+
+	maxRequestIDLen = 128
+)
+
+var (
+	// traceParentRe matches the version, trace ID, parent ID and flags of a W3C traceparent header, later versions
+	// may append fields.
+	traceParentRe = regexp.MustCompile(`^([0-9a-f]{2})-([0-9a-f]{32})-([0-9a-f]{16})-([0-9a-f]{2})(-.*)?$`)
+	requestIDRe   = regexp.MustCompile(`^[A-Za-z0-9._:/+=-]+$`)
+)
+
+// traceParent is a parsed W3C traceparent header.
+type traceParent struct {
+	traceID string
+	flags   string
+}
+
+// parseTraceParent returns the trace ID and flags of a traceparent header, ok is false when it is not valid.
+func parseTraceParent(header string) (tp traceParent, ok bool) {
+	m := traceParentRe.FindStringSubmatch(strings.TrimSpace(header))
+	if m == nil {
+		return traceParent{}, false
+	}
+	version, traceID, parentID, flags, rest := m[1], m[2], m[3], m[4], m[5]
+	if version == "ff" || (version == "00" && rest != "") {
+		return traceParent{}, false
+	}
+	if traceID == strings.Repeat("0", 32) || parentID == strings.Repeat("0", 16) {
+		return traceParent{}, false
+	}
+	return traceParent{traceID: traceID, flags: flags}, true
+}
+
+func validRequestID(id string) bool {
+	return len(id) <= maxRequestIDLen && requestIDRe.MatchString(id)
+}
+
+// TraceIDMiddleware continues the trace of a valid inbound traceparent header, or starts a new trace, and keeps
+// a valid inbound X-Request-ID or generates one. Both are set on the context for logging and error bodies, and
+// returned in the traceresponse and X-Request-ID response headers.
+func TraceIDMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tp, ok := parseTraceParent(r.Header.Get(headerTraceParent))
+		if !ok {
+			tp = traceParent{traceID: randomHex(16), flags: "00"}
+		}
+		requestID := r.Header.Get(headerRequestID)
+		if !validRequestID(requestID) {
+			requestID = uuid.NewString()
+		}
+
+		ctx := log.ContextWithTraceID(r.Context(), tp.traceID)
+		ctx = log.ContextWithRequestID(ctx, requestID)
+
+		// traceresponse has the ID of the span of this server in place of the parent ID
+		w.Header().Set(headerTraceResponse, fmt.Sprintf("00-%s-%s-%s", tp.traceID, randomHex(8), tp.flags))
+		w.Header().Set(headerRequestID, requestID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func randomHex(n int) string {
+	b := make([]byte, n)
+	_, _ = rand.Read(b)
+	return hex.EncodeToString(b)
+}
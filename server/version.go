@@ -0,0 +1,65 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultRootDeprecatedAt is when the unversioned root routes were deprecated in favor of /v1.
+var defaultRootDeprecatedAt = time.Date(2026, time.October, 19, 0, 0, 0, 0, time.UTC)
+
+// apiVersion is a version of the item API mounted under /<name>. Versions share the handlers and the uam.API,
+// and differ in the envelope their responses are wrapped in.
+type apiVersion struct {
+	name string
+	// envelope wraps the value of a successful response, nil responds with the value as is.
+	envelope func(r *http.Request, val any) any
+}
+
+var apiV1 = apiVersion{name: "v1"}
+
+type apiVersionCtxKey struct{}
+
+// WithRootDeprecation sets when the unversioned root routes were deprecated and when they will be removed.
+func WithRootDeprecation(deprecatedAt, sunset time.Time) Option {
+	return func(s *Server) {
+		if !deprecatedAt.IsZero() {
+			s.rootDeprecatedAt = deprecatedAt
+		}
+		if !sunset.IsZero() {
+			s.rootSunset = sunset
+		}
+	}
+}
+
+func apiVersionMiddleware(v apiVersion) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := context.WithValue(r.Context(), apiVersionCtxKey{}, v)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// DeprecationMiddleware marks the responses of the root routes as deprecated (RFC 9745), with the time they will
+// be removed (RFC 8594) and a link to the same route in the latest version.
+func (s *Server) DeprecationMiddleware(successor apiVersion) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Deprecation", fmt.Sprintf("@%d", s.rootDeprecatedAt.Unix()))
+			w.Header().Set("Sunset", s.rootSunset.UTC().Format(http.TimeFormat))
+			w.Header().Add("Link", fmt.Sprintf(`</%s%s>; rel="successor-version"`, successor.name, r.URL.Path))
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// respond writes a successful response in the envelope of the API version of r.
+func respond(w http.ResponseWriter, r *http.Request, code int, val any) {
+	if v, ok := r.Context().Value(apiVersionCtxKey{}).(apiVersion); ok && v.envelope != nil {
+		val = v.envelope(r, val)
+	}
+	successResponse(r.Context(), w, code, val)
+}
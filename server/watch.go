@@ -0,0 +1,124 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/authentication"
+	"github.com/Av1shay/di-demo/events"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"io"
+	"net/http"
+	"time"
+)
+
+const (
+	// watchHeartbeatInterval is how often a comment is sent on idle streams, so proxies keep them open.
+	watchHeartbeatInterval = 15 * time.Second
+	// watchWriteTimeout is the time the client has to read every event, the stream itself is not limited by
+	// the server write timeout.
+	watchWriteTimeout = 10 * time.Second
+	// watchRetry is the reconnection delay clients are told to wait.
+	watchRetry = 3 * time.Second
+
+	// eventReset tells the client events may have been missed, so it has to reload the items.
+	eventReset = "reset"
+)
+
+// WithEventBroker streams the item events of the broker from GET /items/watch, the uam.API publishing the events
+// should use the same broker.
+func WithEventBroker(broker *events.Broker) Option {
+	return func(s *Server) {
+		s.broker = broker
+	}
+}
+
+// WatchItemsHandler streams the item changes of the account as Server-Sent Events. Clients reconnecting with a
+// Last-Event-ID header get the events they missed, or a reset event when they are no longer in the backlog.
+func (s *Server) WatchItemsHandler(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	user, err := authentication.UserFromContext(ctx)
+	if err != nil {
+		errorResponse(w, r, errs.NewUnauthorizedErr(err, "Can't find authenticated user"))
+		return
+	}
+	if s.broker == nil {
+		errorResponse(w, r, &errs.AppError{Code: errs.ErrorCodeNotFound, Msg: "item events are not enabled"})
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	sub, missed, resumed := s.broker.Subscribe(user.AccountID, lastID)
+	defer sub.Close()
+
+	log.Infof(ctx, "WatchItems from event id: %q", lastID)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	// stop nginx from buffering the stream
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	send := func(write func(w io.Writer) error) error {
+		// a deadline for every write instead of the server write timeout, which would end the stream
+		if err := rc.SetWriteDeadline(time.Now().Add(watchWriteTimeout)); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			return err
+		}
+		if err := write(w); err != nil {
+			return err
+		}
+		return rc.Flush()
+	}
+
+	err = send(func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, "retry: %d\n\n", watchRetry.Milliseconds())
+		return err
+	})
+	if err == nil && !resumed {
+		err = send(func(w io.Writer) error {
+			_, err := fmt.Fprintf(w, "event: %s\ndata: {}\n\n", eventReset)
+			return err
+		})
+	}
+	for _, ev := range missed {
+		if err != nil {
+			break
+		}
+		err = send(func(w io.Writer) error { return writeEvent(w, ev) })
+	}
+
+	heartbeat := time.NewTicker(watchHeartbeatInterval)
+	defer heartbeat.Stop()
+	for err == nil {
+		select {
+		case ev, ok := <-sub.Events():
+			if !ok {
+				// the client fell behind, it resumes from the backlog when it reconnects
+				log.Infof(ctx, "WatchItems subscription dropped, overflowed: %t", sub.Overflowed())
+				return
+			}
+			err = send(func(w io.Writer) error { return writeEvent(w, ev) })
+		case <-heartbeat.C:
+			err = send(func(w io.Writer) error {
+				_, err := io.WriteString(w, ": heartbeat\n\n")
+				return err
+			})
+		case <-s.shutdown:
+			return
+		case <-ctx.Done():
+			return
+		}
+	}
+	log.Infof(ctx, "WatchItems stream ended: %v", err)
+}
+
+func writeEvent(w io.Writer, ev events.Event) error {
+	data, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", ev.ID, ev.Type, data)
+	return err
+}
@@ -0,0 +1,66 @@
+package uam
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/pkg/errs"
+	"github.com/Av1shay/di-demo/pkg/log"
+)
+
+// CacheStatus is the runtime state of the cache of this instance.
+type CacheStatus struct {
+	Enabled bool                `json:"enabled"`
+	Breaker *cache.BreakerStats `json:"breaker,omitempty"`
+}
+
+func (a *API) CacheStatus() CacheStatus {
+	status := CacheStatus{Enabled: a.cacheEnabled.Load()}
+	if b, ok := a.cache.(*cache.Breaker); ok {
+		stats := b.Stats()
+		status.Breaker = &stats
+	}
+	return status
+}
+
+// FlushCache deletes the cached items and lists of the account, or of every account when accountID is empty, and
+// returns the number of deleted entries. Other entries, like idempotency records, are kept. In-memory caches of
+// other instances are not flushed.
+func (a *API) FlushCache(ctx context.Context, accountID string) (int, error) {
+	if a.cache == nil {
+		return 0, nil
+	}
+	d, ok := a.cache.(cache.PrefixDeleter)
+	if !ok {
+		return 0, errs.NewBadRequestErr(cache.ErrNotSupported, "The cache does not support flushing")
+	}
+	total := 0
+	for _, prefix := range []string{itemCacheKeyPrefix, listCacheKeyPrefix} {
+		if accountID != "" {
+			prefix += accountID + ":"
+		}
+		n, err := d.DeletePrefix(ctx, prefix)
+		total += n
+		if err != nil {
+			return total, fmt.Errorf("failed to delete cache keys with prefix %s: %w", prefix, err)
+		}
+	}
+	log.Infof(ctx, "Flushed %d cache entries of account %q", total, accountID)
+	return total, nil
+}
+
+// InspectCacheKey returns the decoded value of a cache entry.
+func (a *API) InspectCacheKey(ctx context.Context, key string) (any, error) {
+	if a.cache == nil {
+		return nil, errs.NewNotFoundErr(nil, fmt.Sprintf("key %s not found in cache", key))
+	}
+	var val any
+	if err := a.cache.Get(ctx, key, &val); err != nil {
+		if errors.Is(err, cache.ErrCacheMiss) {
+			return nil, errs.NewNotFoundErr(err, fmt.Sprintf("key %s not found in cache", key))
+		}
+		return nil, fmt.Errorf("failed to get key %s from cache: %w", key, err)
+	}
+	return val, nil
+}
@@ -3,21 +3,32 @@ package uam
 import (
 	"context"
 	"errors"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/cache/invalidation"
+	"github.com/Av1shay/di-demo/events"
+	"github.com/Av1shay/di-demo/pkg/log"
 	"github.com/Av1shay/di-demo/pkg/types"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	itemCacheTTL = time.Hour
-	listCacheTTL = time.Minute
+	defaultItemCacheTTL = time.Hour
+	defaultListCacheTTL = time.Minute
 )
 
 type ItemRepository interface {
+	GetItem(ctx context.Context, id, accountID string) (types.Item, error)
 	GetItemByName(ctx context.Context, name, accountID string) (types.Item, error)
 	SaveItem(ctx context.Context, input types.ItemCreateInput, accountID string) (types.Item, error)
 	UpdateItem(ctx context.Context, input types.UpdateItemInput, accountID string) (types.Item, error)
+	PatchItem(ctx context.Context, input types.PatchItemInput, accountID string) (types.Item, error)
 	ListItems(ctx context.Context, input types.ListItemsInput, accountID string) ([]types.Item, error)
-	DeleteItem(ctx context.Context, id, accountID string) error
+	ListRecentItems(ctx context.Context, input types.RecentItemsInput) ([]types.Item, error)
+	DeleteItem(ctx context.Context, input types.DeleteItemInput, accountID string) error
+	// StreamItems calls fn with every item of the account in creation order, without loading them all in memory.
+	// It stops at the first error returned by fn.
+	StreamItems(ctx context.Context, accountID string, fn func(types.Item) error) error
 }
 
 type Repository interface {
@@ -31,31 +42,113 @@ type Cache interface {
 	Delete(ctx context.Context, key string) error
 }
 
+// InvalidationBus broadcasts cache keys that changed to the other server instances.
+type InvalidationBus interface {
+	Publish(ctx context.Context, keys ...string) error
+	Subscribe(ctx context.Context, handler invalidation.Handler) error
+}
+
+// EventPublisher is notified of every item change after it succeeded.
+type EventPublisher interface {
+	Publish(ctx context.Context, ev events.Event)
+}
+
 type Config struct {
 	CacheEnabled bool
+	ItemCacheTTL time.Duration
+	ListCacheTTL time.Duration
 }
 
 type API struct {
-	cfg   Config
-	repo  Repository
-	cache Cache
+	cfg          Config
+	cacheEnabled atomic.Bool
+	repo         Repository
+	cache        Cache
+	bus          InvalidationBus
+	publisher    EventPublisher
+}
+
+type Option func(a *API)
+
+func WithInvalidationBus(bus InvalidationBus) Option {
+	return func(a *API) {
+		a.bus = bus
+	}
+}
+
+// WithEventPublisher publishes the item changes made through the API to publisher.
+func WithEventPublisher(publisher EventPublisher) Option {
+	return func(a *API) {
+		a.publisher = publisher
+	}
 }
 
-func NewAPI(cfg Config, repo Repository, cache Cache) (*API, error) {
+func NewAPI(cfg Config, repo Repository, cache Cache, opts ...Option) (*API, error) {
 	if cfg.CacheEnabled && cache == nil {
 		return nil, errors.New("cache not set")
 	}
-	return &API{
+	if cfg.ItemCacheTTL <= 0 {
+		cfg.ItemCacheTTL = defaultItemCacheTTL
+	}
+	if cfg.ListCacheTTL <= 0 {
+		cfg.ListCacheTTL = defaultListCacheTTL
+	}
+	a := &API{
 		cfg:   cfg,
 		repo:  repo,
 		cache: cache,
-	}, nil
+	}
+	a.cacheEnabled.Store(cfg.CacheEnabled)
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a, nil
+}
+
+// SubscribeInvalidations evicts keys changed by other instances from the local cache until ctx is done.
+func (a *API) SubscribeInvalidations(ctx context.Context) error {
+	if a.bus == nil {
+		return errors.New("invalidation bus not set")
+	}
+	return a.bus.Subscribe(ctx, func(ctx context.Context, keys []string) {
+		if a.cache == nil {
+			return
+		}
+		for _, key := range keys {
+			if isListCachePrefix(key) {
+				a.evictLists(ctx, key)
+				continue
+			}
+			if err := a.cache.Delete(ctx, key); err != nil {
+				logCacheErr(ctx, "Failed to evict invalidated key from cache", err)
+			}
+		}
+		log.Debugf(ctx, "Evicted %d invalidated cache keys", len(keys))
+	})
 }
 
 func (a *API) HealthCheck(ctx context.Context) error {
 	return a.repo.Ping(ctx)
 }
 
-func (a *API) SetCacheEnabled(v bool) {
-	a.cfg.CacheEnabled = v
+// CacheHealthCheck pings the cache, caches that can't be unreachable are always healthy.
+func (a *API) CacheHealthCheck(ctx context.Context) error {
+	if p, ok := a.cache.(cache.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
+
+// SetCacheEnabled turns caching on or off at runtime. Items changed while caching is off are not evicted, so they
+// may be stale until their entries expire or the cache is flushed.
+func (a *API) SetCacheEnabled(v bool) error {
+	if v && a.cache == nil {
+		return errors.New("cache not set")
+	}
+	a.cacheEnabled.Store(v)
+	return nil
+}
+
+func (a *API) CacheEnabled() bool {
+	return a.cacheEnabled.Load()
 }
@@ -4,88 +4,326 @@ import (
 	"context"
 	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/events"
+	"github.com/Av1shay/di-demo/pkg/errs"
 	"github.com/Av1shay/di-demo/pkg/log"
 	"github.com/Av1shay/di-demo/pkg/types"
+	"strings"
 )
 
 func (a *API) GetItemByName(ctx context.Context, name, accountID string) (types.Item, error) {
-	if a.cfg.CacheEnabled {
+	if a.cacheEnabled.Load() {
 		var item types.Item
-		if err := a.cache.Get(ctx, genItemCacheKey(name, accountID), &item); err == nil {
+		err := a.cache.Get(ctx, genItemCacheKey(name, accountID), &item)
+		if err == nil {
 			return item, nil
 		}
+		logCacheErr(ctx, "Failed to get item from cache", err)
 	}
 	item, err := a.repo.GetItemByName(ctx, name, accountID)
 	if err != nil {
 		return types.Item{}, err
 	}
-	if a.cfg.CacheEnabled {
-		if err := a.cache.Set(ctx, genItemCacheKey(name, accountID), item, itemCacheTTL); err != nil {
-			log.Errorf(ctx, "Failed to save item to cache: %v", err)
+	if a.cacheEnabled.Load() {
+		if err := a.cache.Set(ctx, genItemCacheKey(name, accountID), item, a.cfg.ItemCacheTTL); err != nil {
+			logCacheErr(ctx, "Failed to save item to cache", err)
 		}
 	}
 	return item, nil
 }
 
+// ExportItems calls fn with every item of the account, read from the repository as they are consumed.
+func (a *API) ExportItems(ctx context.Context, accountID string, fn func(types.Item) error) error {
+	return a.repo.StreamItems(ctx, accountID, fn)
+}
+
 func (a *API) CreateItem(ctx context.Context, input types.ItemCreateInput, accountID string) (types.Item, error) {
 	item, err := a.repo.SaveItem(ctx, input, accountID)
 	if err != nil {
 		return types.Item{}, err
 	}
-	if a.cfg.CacheEnabled {
-		if err := a.cache.Set(ctx, genItemCacheKey(input.Name, accountID), item, itemCacheTTL); err != nil {
-			log.Errorf(ctx, "Failed to save item to cache: %v", err)
-		}
+	if a.cacheEnabled.Load() {
+		a.cacheChangedItem(ctx, item, "")
 	}
+	a.publishItemEvent(ctx, events.TypeItemCreated, item)
 	return item, nil
 }
 
 func (a *API) ListItems(ctx context.Context, input types.ListItemsInput, accountID string) ([]types.Item, error) {
 	cacheKey := ""
-	if a.cfg.CacheEnabled {
+	if a.cacheEnabled.Load() {
 		if k, err := genListCacheKey(input, accountID); err == nil {
 			cacheKey = k
 			var items []types.Item
-			if err := a.cache.Get(ctx, cacheKey, &items); err == nil {
+			err := a.cache.Get(ctx, cacheKey, &items)
+			if err == nil {
 				return items, nil
 			}
+			logCacheErr(ctx, "Failed to get list items from cache", err)
 		}
 	}
 	items, err := a.repo.ListItems(ctx, input, accountID)
 	if err != nil {
 		return nil, err
 	}
-	if a.cfg.CacheEnabled && cacheKey != "" {
-		if err := a.cache.Set(ctx, cacheKey, items, listCacheTTL); err != nil {
-			log.Errorf(ctx, "Failed to save list items to cache: %v", err)
+	if a.cacheEnabled.Load() && cacheKey != "" {
+		if err := a.cache.Set(ctx, cacheKey, items, a.cfg.ListCacheTTL); err != nil {
+			logCacheErr(ctx, "Failed to save list items to cache", err)
 		}
 	}
 	return items, nil
 }
 
 func (a *API) UpdateItem(ctx context.Context, input types.UpdateItemInput, accountID string) (types.Item, error) {
+	oldName := ""
+	if a.cacheEnabled.Load() {
+		// the item is cached by name, the current name is needed to evict it when renamed
+		if old, err := a.repo.GetItem(ctx, input.ID, accountID); err == nil {
+			oldName = old.Name
+		}
+	}
 	item, err := a.repo.UpdateItem(ctx, input, accountID)
 	if err != nil {
 		return types.Item{}, err
 	}
-	if a.cfg.CacheEnabled {
-		if input.Name != item.Name {
-			_ = a.cache.Delete(ctx, genItemCacheKey(input.Name, accountID))
+	if a.cacheEnabled.Load() {
+		a.cacheChangedItem(ctx, item, oldName)
+	}
+	a.publishItemEvent(ctx, events.TypeItemUpdated, item)
+	return item, nil
+}
+
+// GetItem returns the item with id, it is always read from the repository since items are cached by name.
+func (a *API) GetItem(ctx context.Context, id, accountID string) (types.Item, error) {
+	return a.repo.GetItem(ctx, id, accountID)
+}
+
+// PatchItem changes the fields set in input and keeps the other fields of the item.
+func (a *API) PatchItem(ctx context.Context, input types.PatchItemInput, accountID string) (types.Item, error) {
+	if input.Name == nil && input.Value == nil {
+		// nothing to change, the version is kept
+		item, err := a.repo.GetItem(ctx, input.ID, accountID)
+		if err != nil {
+			return types.Item{}, err
 		}
-		if err := a.cache.Set(ctx, genItemCacheKey(item.Name, accountID), item, itemCacheTTL); err != nil {
-			log.Errorf(ctx, "Failed to save item to cache: %v", err)
+		if input.ExpectedVersion > 0 && item.Version != input.ExpectedVersion {
+			return types.Item{}, errs.NewPreconditionFailedErr(nil, fmt.Sprintf("item with id %s is not at version %d", input.ID, input.ExpectedVersion))
 		}
+		return item, nil
 	}
+	oldName := ""
+	if a.cacheEnabled.Load() && input.Name != nil {
+		// the item is cached by name, the current name is needed to evict it when renamed
+		if old, err := a.repo.GetItem(ctx, input.ID, accountID); err == nil {
+			oldName = old.Name
+		}
+	}
+	item, err := a.repo.PatchItem(ctx, input, accountID)
+	if err != nil {
+		return types.Item{}, err
+	}
+	if a.cacheEnabled.Load() {
+		a.cacheChangedItem(ctx, item, oldName)
+	}
+	a.publishItemEvent(ctx, events.TypeItemUpdated, item)
 	return item, nil
 }
 
-func (a *API) DeleteItem(ctx context.Context, id, accountID string) error {
-	return a.repo.DeleteItem(ctx, id, accountID)
+// ImportItems creates the items of a chunk of imported rows, rows with the name of an existing item are skipped,
+// overwrite the item or abort the import according to input.Policy. Rows that fail are reported in the summary,
+// the error is only set when the repository failed.
+func (a *API) ImportItems(ctx context.Context, input types.ImportItemsInput, accountID string) (types.ImportSummary, error) {
+	var (
+		sum  types.ImportSummary
+		keys []string
+	)
+	defer func() {
+		if a.cacheEnabled.Load() && len(keys) > 0 {
+			a.evictItems(ctx, accountID, keys)
+		}
+	}()
+	for _, row := range input.Rows {
+		item, err := a.repo.SaveItem(ctx, row.ItemCreateInput, accountID)
+		if err == nil {
+			sum.Created++
+			keys = append(keys, genItemCacheKey(row.Name, accountID))
+			a.publishItemEvent(ctx, events.TypeItemCreated, item)
+			continue
+		}
+		var appErr *errs.AppError
+		if !errors.As(err, &appErr) {
+			return sum, err
+		}
+		res := types.ImportRowResult{Line: row.Line, Name: row.Name, Status: types.ImportRowFailed, Error: appErr.Msg}
+		if appErr.Code != errs.ErrorCodeDuplicate {
+			sum.AddRow(res)
+			continue
+		}
+		switch input.Policy {
+		case types.ImportPolicySkip:
+			res.Status, res.Error = types.ImportRowSkipped, ""
+		case types.ImportPolicyOverwrite:
+			if err := a.overwriteItem(ctx, row, accountID); err != nil {
+				if !errors.As(err, &appErr) {
+					return sum, err
+				}
+				res.Error = appErr.Msg
+				break
+			}
+			res.Status, res.Error = types.ImportRowUpdated, ""
+			keys = append(keys, genItemCacheKey(row.Name, accountID))
+		default:
+			sum.AddRow(res)
+			sum.Aborted = true
+			return sum, nil
+		}
+		sum.AddRow(res)
+	}
+	return sum, nil
+}
+
+// overwriteItem sets the value of the existing item with the name of row, it fails if the item changes meanwhile.
+func (a *API) overwriteItem(ctx context.Context, row types.ImportRow, accountID string) error {
+	existing, err := a.repo.GetItemByName(ctx, row.Name, accountID)
+	if err != nil {
+		return err
+	}
+	item, err := a.repo.UpdateItem(ctx, types.UpdateItemInput{
+		ID:              existing.ID,
+		Name:            row.Name,
+		Value:           row.Value,
+		ExpectedVersion: existing.Version,
+	}, accountID)
+	if err != nil {
+		return err
+	}
+	a.publishItemEvent(ctx, events.TypeItemUpdated, item)
+	return nil
+}
+
+// evictItems deletes keys and the cached lists of the account from the cache of this instance and of all the
+// other instances.
+func (a *API) evictItems(ctx context.Context, accountID string, keys []string) {
+	for _, key := range keys {
+		if err := a.cache.Delete(ctx, key); err != nil {
+			logCacheErr(ctx, "Failed to delete item from cache", err)
+		}
+	}
+	a.evictLists(ctx, genListCachePrefix(accountID))
+	a.publishInvalidation(ctx, append(keys, genListCachePrefix(accountID))...)
+}
+
+// cacheChangedItem caches item and evicts it and the cached lists of its account from the caches of all instances,
+// under its old name too when renamed.
+func (a *API) cacheChangedItem(ctx context.Context, item types.Item, oldName string) {
+	keys := []string{genItemCacheKey(item.Name, item.AccountID)}
+	if oldName != "" && oldName != item.Name {
+		oldKey := genItemCacheKey(oldName, item.AccountID)
+		if err := a.cache.Delete(ctx, oldKey); err != nil {
+			logCacheErr(ctx, "Failed to delete item from cache", err)
+		}
+		keys = append(keys, oldKey)
+	}
+	if err := a.cache.Set(ctx, genItemCacheKey(item.Name, item.AccountID), item, a.cfg.ItemCacheTTL); err != nil {
+		logCacheErr(ctx, "Failed to save item to cache", err)
+	}
+	a.evictLists(ctx, genListCachePrefix(item.AccountID))
+	a.publishInvalidation(ctx, append(keys, genListCachePrefix(item.AccountID))...)
+}
+
+// evictLists deletes the cached lists starting with prefix from the cache of this instance.
+func (a *API) evictLists(ctx context.Context, prefix string) {
+	d, ok := a.cache.(cache.PrefixDeleter)
+	if !ok {
+		log.Debugf(ctx, "Cache does not support deleting by prefix, lists are kept until they expire")
+		return
+	}
+	if _, err := d.DeletePrefix(ctx, prefix); err != nil {
+		logCacheErr(ctx, "Failed to delete lists from cache", err)
+	}
+}
+
+func (a *API) DeleteItem(ctx context.Context, input types.DeleteItemInput, accountID string) error {
+	if !a.cacheEnabled.Load() {
+		if err := a.repo.DeleteItem(ctx, input, accountID); err != nil {
+			return err
+		}
+		a.publishDeleteEvent(ctx, input.ID, accountID)
+		return nil
+	}
+
+	// the item is cached by name, so it has to be fetched before it is deleted
+	item, err := a.repo.GetItem(ctx, input.ID, accountID)
+	if err != nil {
+		var appErr *errs.AppError
+		if errors.As(err, &appErr) && appErr.Code == errs.ErrorCodeNotFound {
+			return a.repo.DeleteItem(ctx, input, accountID)
+		}
+		return err
+	}
+	if err := a.repo.DeleteItem(ctx, input, accountID); err != nil {
+		return err
+	}
+
+	a.evictItems(ctx, accountID, []string{genItemCacheKey(item.Name, accountID)})
+	a.publishDeleteEvent(ctx, input.ID, accountID)
+	return nil
+}
+
+func (a *API) publishItemEvent(ctx context.Context, typ events.Type, item types.Item) {
+	if a.publisher == nil {
+		return
+	}
+	a.publisher.Publish(ctx, events.Event{Type: typ, AccountID: item.AccountID, ItemID: item.ID, Item: &item})
+}
+
+func (a *API) publishDeleteEvent(ctx context.Context, id, accountID string) {
+	if a.publisher == nil {
+		return
+	}
+	a.publisher.Publish(ctx, events.Event{Type: events.TypeItemDeleted, AccountID: accountID, ItemID: id})
+}
+
+func (a *API) publishInvalidation(ctx context.Context, keys ...string) {
+	if a.bus == nil {
+		return
+	}
+	if err := a.bus.Publish(ctx, keys...); err != nil {
+		log.Errorf(ctx, "Failed to publish cache invalidation: %v", err)
+	}
 }
 
+// logCacheErr logs cache failures, misses and bypassed calls are expected and only logged in debug.
+func logCacheErr(ctx context.Context, msg string, err error) {
+	switch {
+	case errors.Is(err, cache.ErrCacheMiss), errors.Is(err, cache.ErrCacheUnavailable):
+		log.Debugf(ctx, "%s: %v", msg, err)
+	default:
+		log.Errorf(ctx, "%s: %v", msg, err)
+	}
+}
+
+// the cache keys start with the account id, so the entries of an account can be flushed by prefix
+const (
+	itemCacheKeyPrefix = "item:"
+	listCacheKeyPrefix = "list:"
+)
+
 func genItemCacheKey(name, accountID string) string {
-	return fmt.Sprintf("item:%s:%s", name, accountID)
+	return fmt.Sprintf("%s%s:%s", itemCacheKeyPrefix, accountID, name)
+}
+
+// genListCachePrefix returns the prefix of the cached lists of the account. Unlike list keys, which end with a hash,
+// it ends with a colon, so it can be told apart when broadcast with the invalidated keys.
+func genListCachePrefix(accountID string) string {
+	return listCacheKeyPrefix + accountID + ":"
+}
+
+func isListCachePrefix(key string) bool {
+	return strings.HasPrefix(key, listCacheKeyPrefix) && strings.HasSuffix(key, ":")
 }
 
 func genListCacheKey(input types.ListItemsInput, accountID string) (string, error) {
@@ -94,5 +332,5 @@ func genListCacheKey(input types.ListItemsInput, accountID string) (string, erro
 		return "", fmt.Errorf("failed to serialize input: %w", err)
 	}
 	hash := sha256.Sum256(append(inputBytes, []byte(accountID)...))
-	return fmt.Sprintf("%x", hash), nil
+	return fmt.Sprintf("%s%x", genListCachePrefix(accountID), hash), nil
 }
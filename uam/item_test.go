@@ -3,8 +3,10 @@ package uam
 import (
 	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
+	"github.com/Av1shay/di-demo/cache"
+	"github.com/Av1shay/di-demo/cache/codec"
+	"github.com/Av1shay/di-demo/cache/invalidation"
 	"github.com/Av1shay/di-demo/cache/memory"
 	"github.com/Av1shay/di-demo/cache/redis"
 	"github.com/Av1shay/di-demo/pkg/errs"
@@ -73,6 +75,182 @@ func TestAPI_GetItem(t *testing.T) {
 	})
 }
 
+func TestAPI_CacheInvalidation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := types.Item{
+		ID:        gofakeit.UUID(),
+		AccountID: gofakeit.UUID(),
+		Name:      "test-item-" + gofakeit.LetterN(6),
+		Value:     "item-value-" + gofakeit.UUID(),
+		Version:   1,
+	}
+	updatedItem := item
+	updatedItem.Value = "item-value-" + gofakeit.UUID()
+	updatedItem.Version = 2
+
+	mockRepo := mock.Repository{
+		GetItemRes:       item,
+		GetItemByNameRes: item,
+		UpdateItemRes:    updatedItem,
+	}
+	hub := invalidation.NewHub()
+
+	cache1, cache2 := memory.NewCache(), memory.NewCache()
+	api1, err := NewAPI(Config{CacheEnabled: true}, &mockRepo, cache1, WithInvalidationBus(hub.NewBus()))
+	require.NoError(t, err)
+	require.NoError(t, api1.SubscribeInvalidations(ctx))
+	api2, err := NewAPI(Config{CacheEnabled: true}, &mockRepo, cache2, WithInvalidationBus(hub.NewBus()))
+	require.NoError(t, err)
+	require.NoError(t, api2.SubscribeInvalidations(ctx))
+
+	// both instances cache the item
+	_, err = api1.GetItemByName(ctx, item.Name, item.AccountID)
+	require.NoError(t, err)
+	_, err = api2.GetItemByName(ctx, item.Name, item.AccountID)
+	require.NoError(t, err)
+
+	key := genItemCacheKey(item.Name, item.AccountID)
+
+	_, err = api1.UpdateItem(ctx, types.UpdateItemInput{ID: item.ID, Name: item.Name, Value: updatedItem.Value}, item.AccountID)
+	require.NoError(t, err)
+
+	var got types.Item
+	require.NoError(t, cache1.Get(ctx, key, &got))
+	require.Equal(t, updatedItem.Version, got.Version)
+	require.ErrorIs(t, cache2.Get(ctx, key, &got), cache.ErrCacheMiss)
+
+	// instance 2 reloads the item, then instance 1 deletes it
+	mockRepo.GetItemByNameRes = updatedItem
+	_, err = api2.GetItemByName(ctx, item.Name, item.AccountID)
+	require.NoError(t, err)
+	require.NoError(t, api1.DeleteItem(ctx, types.DeleteItemInput{ID: item.ID}, item.AccountID))
+	require.ErrorIs(t, cache1.Get(ctx, key, &got), cache.ErrCacheMiss)
+	require.ErrorIs(t, cache2.Get(ctx, key, &got), cache.ErrCacheMiss)
+
+	// imports overwriting the item evict it from both instances
+	mockRepo.SaveItemErrs = map[string]error{item.Name: &errs.AppError{Code: errs.ErrorCodeDuplicate}}
+	_, err = api1.GetItemByName(ctx, item.Name, item.AccountID)
+	require.NoError(t, err)
+	_, err = api2.GetItemByName(ctx, item.Name, item.AccountID)
+	require.NoError(t, err)
+	sum, err := api1.ImportItems(ctx, types.ImportItemsInput{
+		Rows:   []types.ImportRow{{Line: 1, ItemCreateInput: types.ItemCreateInput{Name: item.Name, Value: "imported"}}},
+		Policy: types.ImportPolicyOverwrite,
+	}, item.AccountID)
+	require.NoError(t, err)
+	require.Equal(t, 1, sum.Updated)
+	require.Equal(t, "imported", mockRepo.UpdateItemIn.Value)
+	require.ErrorIs(t, cache1.Get(ctx, key, &got), cache.ErrCacheMiss)
+	require.ErrorIs(t, cache2.Get(ctx, key, &got), cache.ErrCacheMiss)
+}
+
+func TestAPI_ListCacheInvalidation(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	item := types.Item{
+		ID:        gofakeit.UUID(),
+		AccountID: gofakeit.UUID(),
+		Name:      "test-item-" + gofakeit.LetterN(6),
+		Value:     "item-value-" + gofakeit.UUID(),
+		Version:   1,
+	}
+	mockRepo := mock.Repository{
+		GetItemRes:    item,
+		SaveItemRes:   item,
+		UpdateItemRes: item,
+		ListItemsRes:  []types.Item{item},
+	}
+	hub := invalidation.NewHub()
+
+	cache1, cache2 := memory.NewCache(), memory.NewCache()
+	api1, err := NewAPI(Config{CacheEnabled: true}, &mockRepo, cache1, WithInvalidationBus(hub.NewBus()))
+	require.NoError(t, err)
+	require.NoError(t, api1.SubscribeInvalidations(ctx))
+	api2, err := NewAPI(Config{CacheEnabled: true}, &mockRepo, cache2, WithInvalidationBus(hub.NewBus()))
+	require.NoError(t, err)
+	require.NoError(t, api2.SubscribeInvalidations(ctx))
+
+	input := types.ListItemsInput{Limit: 10}
+	listKey, err := genListCacheKey(input, item.AccountID)
+	require.NoError(t, err)
+	otherAccountKey, err := genListCacheKey(input, gofakeit.UUID())
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		name   string
+		mutate func() error
+	}{
+		{name: "create", mutate: func() error {
+			_, err := api1.CreateItem(ctx, types.ItemCreateInput{Name: item.Name, Value: item.Value}, item.AccountID)
+			return err
+		}},
+		{name: "update", mutate: func() error {
+			_, err := api1.UpdateItem(ctx, types.UpdateItemInput{ID: item.ID, Name: item.Name, Value: item.Value}, item.AccountID)
+			return err
+		}},
+		{name: "delete", mutate: func() error {
+			return api1.DeleteItem(ctx, types.DeleteItemInput{ID: item.ID}, item.AccountID)
+		}},
+	} {
+		// both instances cache the list, and a list of another account that must be kept
+		_, err = api1.ListItems(ctx, input, item.AccountID)
+		require.NoError(t, err)
+		_, err = api2.ListItems(ctx, input, item.AccountID)
+		require.NoError(t, err)
+		require.NoError(t, cache2.Set(ctx, otherAccountKey, []types.Item{}, time.Minute))
+
+		require.NoError(t, tc.mutate(), tc.name)
+
+		var got []types.Item
+		require.ErrorIs(t, cache1.Get(ctx, listKey, &got), cache.ErrCacheMiss, tc.name)
+		require.ErrorIs(t, cache2.Get(ctx, listKey, &got), cache.ErrCacheMiss, tc.name)
+		require.NoError(t, cache2.Get(ctx, otherAccountKey, &got), tc.name)
+	}
+}
+
+func TestAPI_WarmUp(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	accountID := gofakeit.UUID()
+	items := make([]types.Item, 3)
+	for i := range items {
+		items[i] = types.Item{
+			ID:        gofakeit.UUID(),
+			AccountID: accountID,
+			Name:      "test-item-" + gofakeit.LetterN(6),
+			Value:     "item-value-" + gofakeit.UUID(),
+		}
+	}
+	mockRepo := mock.Repository{ListRecentRes: items}
+	memoryCache := memory.NewCache()
+
+	api, err := NewAPI(Config{CacheEnabled: true}, &mockRepo, memoryCache)
+	require.NoError(t, err)
+
+	n, err := api.WarmUp(ctx, WarmUpOptions{ItemsPerAccount: 5, MaxItems: 100})
+	require.NoError(t, err)
+	require.Equal(t, len(items), n)
+	require.Equal(t, types.RecentItemsInput{PerAccount: 5, Limit: 100}, mockRepo.ListRecentIn)
+
+	for _, item := range items {
+		var got types.Item
+		require.NoError(t, memoryCache.Get(ctx, genItemCacheKey(item.Name, accountID), &got))
+		require.Equal(t, item, got)
+	}
+
+	require.NoError(t, api.SetCacheEnabled(false))
+	n, err = api.WarmUp(ctx, WarmUpOptions{})
+	require.NoError(t, err)
+	require.Zero(t, n)
+}
+
 func TestAPI_GetItem_Integration_MySQL(t *testing.T) {
 	t.Parallel()
 
@@ -117,7 +295,7 @@ func TestAPI_GetItem_Integration_MySQL(t *testing.T) {
 		cachedItem, err := rdb.Get(ctx, redis.BuildKey(genItemCacheKey(createdItem.Name, accountID))).Bytes()
 		require.NoError(t, err)
 		var gotCachedItem types.Item
-		require.NoError(t, json.Unmarshal(cachedItem, &gotCachedItem))
+		require.NoError(t, codec.Default().Unmarshal(cachedItem, &gotCachedItem))
 		require.Equal(t, createdItem, gotCachedItem)
 
 		gotItem, err := api.GetItemByName(ctx, createdItem.Name, accountID)
@@ -217,6 +395,17 @@ func TestAPI_ListItems_Integration_MySQL(t *testing.T) {
 		Value: "item-value-" + gofakeit.UUID(),
 	}, accountID)
 	require.NoError(t, err)
+
+	// updates conditioned on a stale version fail
+	_, err = api.UpdateItem(ctx, types.UpdateItemInput{
+		ID:              items[0].ID,
+		Name:            items[0].Name,
+		ExpectedVersion: items[0].Version,
+	}, accountID)
+	var versionErr *errs.AppError
+	require.ErrorAs(t, err, &versionErr)
+	require.Equal(t, errs.ErrorCodePrecondition, versionErr.Code)
+
 	gotItems, err = api.ListItems(ctx, types.ListItemsInput{
 		OrderBy: types.OrderByUpdatedAt,
 		Sort:    types.DESC,
@@ -226,12 +415,31 @@ func TestAPI_ListItems_Integration_MySQL(t *testing.T) {
 	require.Equal(t, items[0].ID, gotItems[0].ID)
 	require.Equal(t, items[0].Name, gotItems[0].Name)
 
+	// patches change only the fields that are set
+	newValue := "item-value-" + gofakeit.UUID()
+	patched, err := api.PatchItem(ctx, types.PatchItemInput{ID: items[1].ID, Value: &newValue}, accountID)
+	require.NoError(t, err)
+	require.Equal(t, items[1].Name, patched.Name)
+	require.Equal(t, newValue, patched.Value)
+	require.Equal(t, items[1].Version+1, patched.Version)
+
+	// exports stream every item of the account in creation order
+	var exported []types.Item
+	err = api.ExportItems(ctx, accountID, func(item types.Item) error {
+		exported = append(exported, item)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, exported, itemsCount)
+	require.Equal(t, items[0].ID, exported[0].ID)
+	require.Equal(t, patched, exported[1])
+
 	gotItems, err = api.ListItems(ctx, types.ListItemsInput{Limit: 2}, accountID)
 	require.NoError(t, err)
 	require.Len(t, gotItems, 2)
 
 	// check cache
-	api.SetCacheEnabled(true)
+	require.NoError(t, api.SetCacheEnabled(true))
 	gotItems, err = api.ListItems(ctx, types.ListItemsInput{Limit: 2}, accountID)
 	require.NoError(t, err)
 	require.Len(t, gotItems, 2)
@@ -297,6 +505,17 @@ func TestAPI_ListItems_Integration_Mongo(t *testing.T) {
 		Value: "item-value-" + gofakeit.UUID(),
 	}, accountID)
 	require.NoError(t, err)
+
+	// updates conditioned on a stale version fail
+	_, err = api.UpdateItem(ctx, types.UpdateItemInput{
+		ID:              items[0].ID,
+		Name:            items[0].Name,
+		ExpectedVersion: items[0].Version,
+	}, accountID)
+	var versionErr *errs.AppError
+	require.ErrorAs(t, err, &versionErr)
+	require.Equal(t, errs.ErrorCodePrecondition, versionErr.Code)
+
 	gotItems, err = api.ListItems(ctx, types.ListItemsInput{
 		OrderBy: types.OrderByUpdatedAt,
 		Sort:    types.DESC,
@@ -306,12 +525,34 @@ func TestAPI_ListItems_Integration_Mongo(t *testing.T) {
 	require.Equal(t, items[0].ID, gotItems[0].ID)
 	require.Equal(t, items[0].Name, gotItems[0].Name)
 
+	// patches change only the fields that are set
+	newValue := "item-value-" + gofakeit.UUID()
+	patched, err := api.PatchItem(ctx, types.PatchItemInput{ID: items[1].ID, Value: &newValue}, accountID)
+	require.NoError(t, err)
+	require.Equal(t, items[1].Name, patched.Name)
+	require.Equal(t, newValue, patched.Value)
+	require.Equal(t, items[1].Version+1, patched.Version)
+
+	// exports stream every item of the account in creation order
+	var exported []types.Item
+	err = api.ExportItems(ctx, accountID, func(item types.Item) error {
+		exported = append(exported, item)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Len(t, exported, itemsCount)
+	require.Equal(t, items[0].ID, exported[0].ID)
+	require.Equal(t, patched, exported[1])
+
 	gotItems, err = api.ListItems(ctx, types.ListItemsInput{Limit: 2}, accountID)
 	require.NoError(t, err)
 	require.Len(t, gotItems, 2)
 
 	itemToDelete := items[0]
-	err = api.DeleteItem(ctx, itemToDelete.ID, accountID)
+	err = api.DeleteItem(ctx, types.DeleteItemInput{ID: itemToDelete.ID, ExpectedVersion: itemToDelete.Version}, accountID)
+	require.ErrorAs(t, err, &versionErr)
+	require.Equal(t, errs.ErrorCodePrecondition, versionErr.Code)
+	err = api.DeleteItem(ctx, types.DeleteItemInput{ID: itemToDelete.ID, ExpectedVersion: itemToDelete.Version + 1}, accountID)
 	require.NoError(t, err)
 	_, err = api.GetItemByName(ctx, itemToDelete.Name, accountID)
 	var appErr *errs.AppError
@@ -0,0 +1,67 @@
+package uam
+
+import (
+	"context"
+	"errors"
+	"github.com/Av1shay/di-demo/pkg/log"
+	"github.com/Av1shay/di-demo/pkg/types"
+	"time"
+)
+
+const (
+	defaultWarmUpItemsPerAccount = 10
+	defaultWarmUpMaxItems        = 1000
+	defaultWarmUpTimeout         = 10 * time.Second
+)
+
+type WarmUpOptions struct {
+	ItemsPerAccount int
+	MaxItems        int
+	Timeout         time.Duration
+}
+
+// WarmUp loads the most recently updated items of every account into the cache.
+// It stops when the time budget is exhausted and returns the number of cached items.
+func (a *API) WarmUp(ctx context.Context, opts WarmUpOptions) (int, error) {
+	if !a.cacheEnabled.Load() {
+		return 0, nil
+	}
+	if opts.ItemsPerAccount <= 0 {
+		opts.ItemsPerAccount = defaultWarmUpItemsPerAccount
+	}
+	if opts.MaxItems <= 0 {
+		opts.MaxItems = defaultWarmUpMaxItems
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = defaultWarmUpTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, opts.Timeout)
+	defer cancel()
+
+	items, err := a.repo.ListRecentItems(ctx, types.RecentItemsInput{
+		PerAccount: opts.ItemsPerAccount,
+		Limit:      opts.MaxItems,
+	})
+	if err != nil {
+		if errors.Is(err, context.DeadlineExceeded) {
+			log.Infof(ctx, "Cache warm-up time budget exceeded before items were loaded")
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	cached := 0
+	for _, item := range items {
+		if ctx.Err() != nil {
+			log.Infof(ctx, "Cache warm-up time budget exceeded, cached %d of %d items", cached, len(items))
+			break
+		}
+		if err := a.cache.Set(ctx, genItemCacheKey(item.Name, item.AccountID), item, a.cfg.ItemCacheTTL); err != nil {
+			logCacheErr(ctx, "Failed to save item to cache", err)
+			continue
+		}
+		cached++
+	}
+	return cached, nil
+}